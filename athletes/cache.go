@@ -0,0 +1,46 @@
+package athletes
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// etagEpoch identifies the server process in ETags. Versions of leaderboard start over
+// after restart and differ between cluster instances, so the same version of another
+// process is not the same leaderboard
+var etagEpoch = strconv.FormatInt(time.Now().UnixNano(), 36)
+
+// leaderboardETag is a weak ETag of leaderboard version. It is weak because
+// the same version is served in different encodings and pages
+func leaderboardETag(version uint64) string {
+	return `W/"` + etagEpoch + "-" + strconv.FormatUint(version, 10) + `"`
+}
+
+// notModified sets ETag, Cache-Control and X-Leaderboard-Version headers of leaderboard
+// version and responds with 304 status if If-None-Match header of request matches the ETag.
+// Responses are cached by clients and proxies but revalidated on every request.
+// Returns true if response was written
+func notModified(w http.ResponseWriter, r *http.Request, version uint64) bool {
+	etag := leaderboardETag(version)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Leaderboard-Version", strconv.FormatUint(version, 10))
+	if !etagMatches(r.Header.Get("If-None-Match"), etag) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches reports whether If-None-Match header value matches etag using weak comparison
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package athletes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEtagMatches(t *testing.T) {
+	assert.Equal(t, true, etagMatches(`W/"3"`, `W/"3"`))
+	assert.Equal(t, true, etagMatches(`"3"`, `W/"3"`))
+	assert.Equal(t, true, etagMatches(`W/"1", W/"3"`, `W/"3"`))
+	assert.Equal(t, true, etagMatches(`*`, `W/"3"`))
+	assert.Equal(t, false, etagMatches(``, `W/"3"`))
+	assert.Equal(t, false, etagMatches(`W/"33"`, `W/"3"`))
+}
+
+func TestLeaderboardVersion(t *testing.T) {
+	leaderboard, _ := newLeaderboard(&storeMock{})
+	_, version := leaderboard.Snapshot()
+	assert.Equal(t, uint64(1), version)
+
+	leaderboard.FindAndUpdate("d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", "finish_corridor", "00:01:10")
+	_, version = leaderboard.Snapshot()
+	assert.Equal(t, uint64(2), version)
+
+	// Failed update does not change version
+	leaderboard.FindAndUpdate("non-existing-chip-id", "finish_corridor", "00:01:10")
+	leaderboard.AssignChip("aaaaaaaa-e63e-442c-98c4-1be4ac871367", 42, "")
+	_, version = leaderboard.Snapshot()
+	assert.Equal(t, uint64(2), version)
+
+	leaderboard.SetRules(DefaultRules)
+	_, version = leaderboard.Snapshot()
+	assert.Equal(t, uint64(3), version)
+
+	// Gun times change version even if rows do not change
+	assert.Equal(t, false, leaderboard.SetStarts(map[string]string{}))
+	_, version = leaderboard.Snapshot()
+	assert.Equal(t, uint64(4), version)
+}
+
+func TestConditionalLeaderboardRequest(t *testing.T) {
+	service := newTestService(t)
+	handler := service.LeaderboardHandler()
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/leaderboard", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.Equal(t, leaderboardETag(1), etag)
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "1", w.Header().Get("X-Leaderboard-Version"))
+
+	r := httptest.NewRequest("GET", "/leaderboard", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	handler(w, r)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, 0, w.Body.Len())
+
+	// The same version of another server process does not match
+	r.Header.Set("If-None-Match", `W/"1"`)
+	w = httptest.NewRecorder()
+	handler(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Update and race started by it change version
+	service.processTimingEvent(timingRequest{"d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", "finish_corridor", "00:01:10", ""})
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	handler(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, leaderboardETag(3), w.Header().Get("ETag"))
+
+	// Race change without changed rows changes version
+	r.Header.Set("If-None-Match", leaderboardETag(3))
+	_, err := service.TransitionRace("finish", "")
+	assert.Equal(t, nil, err)
+	w = httptest.NewRecorder()
+	handler(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, RaceFinished, w.Header().Get("X-Race-State"))
+}
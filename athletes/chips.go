@@ -0,0 +1,229 @@
+package athletes
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+type assignChipRequest struct {
+	ChipID      string `json:"chip_id" validate:"required,uuid4"`
+	StartNumber int    `json:"start_number" validate:"required"`
+	Reassign    bool   `json:"reassign"`
+}
+
+// AssignChipResponse contains LeaderboardRow after chip assignment and
+// quarantined reads which were applied to it
+type AssignChipResponse struct {
+	Row          LeaderboardRow  `json:"row"`
+	AppliedReads []UnmatchedRead `json:"applied_reads"`
+}
+
+// AssignChip assigns chipID to athlete with startNumber in addition to chips athlete
+// already has. If chipID is assigned to another athlete, it is moved only when reassign
+// is set. Timings already recorded with the chip stay with the previous athlete, reads
+// received after reassignment are applied to the new one. Late reads are credited by
+// their clock time to the athlete chip was assigned to when read.
+//
+// Assignment is saved in store, then quarantined reads of the chip are applied in
+// order they were received and all connected ws clients are notified about updated row.
+// Returns updated row and applied reads
+func (s Service) AssignChip(chipID string, startNumber int, reassign bool) (LeaderboardRow, []UnmatchedRead, error) {
+	previous, err := s.leadeboard.Find(chipID)
+	assigned := err == nil
+	moved := assigned && previous.StartNumber != startNumber
+	if moved && !reassign {
+		return LeaderboardRow{}, nil, ChipAlreadyAssigned{chipID, previous.StartNumber}
+	}
+	now := time.Now()
+	clockTime := now.Format(clockTimeFormat)
+	if moved {
+		if _, err := s.leadeboard.UnassignChip(chipID, clockTime); err != nil {
+			return LeaderboardRow{}, nil, err
+		}
+	}
+	row, err := s.leadeboard.AssignChip(chipID, startNumber, clockTime)
+	if err != nil {
+		s.restoreChip(chipID, previous, moved)
+		return row, nil, err
+	}
+	if !assigned || moved {
+		if err := s.store.AssignChip(chipID, startNumber, now); err != nil {
+			s.leadeboard.UnassignChip(chipID, clockTime)
+			s.restoreChip(chipID, previous, moved)
+			return LeaderboardRow{}, nil, err
+		}
+	}
+
+	row, reads, err := s.applyUnmatched(chipID, row)
+	if err != nil {
+		return row, nil, err
+	}
+	s.publish(replicatedEvent{Kind: replicatedAssignChip, ChipID: chipID, StartNumber: startNumber, ClockTime: clockTime})
+	if moved {
+		s.logger.Infof("Chip %s: reassigned from %d to %d", chipID, previous.StartNumber, startNumber)
+	}
+	s.logger.Infof("Chip %s: assigned to %d, %d quarantined reads applied", chipID, startNumber, len(reads))
+	s.broadcastRow(row)
+	return row, reads, nil
+}
+
+// applyUnmatched applies quarantined reads of chipID in order they were received.
+// Returns row after the last read and applied reads
+func (s Service) applyUnmatched(chipID string, row LeaderboardRow) (LeaderboardRow, []UnmatchedRead, error) {
+	reads := s.unmatched.take(chipID)
+	for _, read := range reads {
+		var err error
+		row, err = s.leadeboard.FindAndUpdateCorrected(read.ChipID, read.TimingPointID, read.ClockTime, read.RawClockTime)
+		if err != nil {
+			return row, nil, err
+		}
+	}
+	return row, reads, nil
+}
+
+// restoreChip assigns chipID back to previous athlete after failed reassignment
+func (s Service) restoreChip(chipID string, previous LeaderboardRow, moved bool) {
+	if moved {
+		s.leadeboard.AssignChip(chipID, previous.StartNumber, "")
+	}
+}
+
+// UnassignChip ends assignment of chipID in store and removes it from athlete.
+// Further reads of the chip are quarantined. Returns row chip was assigned to
+func (s Service) UnassignChip(chipID string) (LeaderboardRow, error) {
+	now := time.Now()
+	clockTime := now.Format(clockTimeFormat)
+	row, err := s.leadeboard.UnassignChip(chipID, clockTime)
+	if err != nil {
+		return row, err
+	}
+	if err := s.store.UnassignChip(chipID, now); err != nil {
+		s.leadeboard.AssignChip(chipID, row.StartNumber, clockTime)
+		return LeaderboardRow{}, err
+	}
+	s.publish(replicatedEvent{Kind: replicatedUnassignChip, ChipID: chipID, ClockTime: clockTime})
+	s.logger.Infof("Chip %s: unassigned from %d", chipID, row.StartNumber)
+	return row, nil
+}
+
+// AssignChipHandler receives assignChipRequest, passes it to Service.AssignChip
+// and responds with AssignChipResponse
+func (s Service) AssignChipHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		assignData := assignChipRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&assignData); err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.Validate(assignData); err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		row, reads, err := s.AssignChip(assignData.ChipID, assignData.StartNumber, assignData.Reassign)
+		if errors.As(err, &StartNumberNotFound{}) {
+			writeError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if errors.As(err, &ChipAlreadyAssigned{}) {
+			writeError(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			s.requestLogger(r).Errorln(err.Error())
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		jsonData, err := json.Marshal(AssignChipResponse{row, reads})
+		if err != nil {
+			s.requestLogger(r).Errorln(err.Error())
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, jsonData, http.StatusOK)
+	}
+}
+
+// UnassignChipHandler passes chipID url parameter to Service.UnassignChip
+// and responds with LeaderboardRow chip was assigned to
+func (s Service) UnassignChipHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		row, err := s.UnassignChip(chi.URLParam(r, "chipID"))
+		if errors.As(err, &AtheleteNotFound{}) {
+			writeError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			s.requestLogger(r).Errorln(err.Error())
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		jsonData, err := json.Marshal(row)
+		if err != nil {
+			s.requestLogger(r).Errorln(err.Error())
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, jsonData, http.StatusOK)
+	}
+}
+
+// sharedStore reports whether store is shared by instances of cluster and so already has
+// chip assignments made by other instances. Memory and SQLite stores are private to instance
+func (s Service) sharedStore() bool {
+	_, shared := s.store.(store)
+	return shared
+}
+
+// storeChip saves replicated or journaled assignment of chipID to athlete with startNumber
+// at clockTime of today in private store, startNumber 0 unassigns the chip. Store which
+// already has the assignment is left as is
+func (s Service) storeChip(chipID string, startNumber int, clockTime string) error {
+	if s.sharedStore() {
+		return nil
+	}
+	chips, err := s.store.FindChips()
+	if err != nil {
+		return err
+	}
+	owner := 0
+	for _, c := range chips.current() {
+		if c.ChipID == chipID {
+			owner = c.StartNumber
+		}
+	}
+	if owner == startNumber {
+		return nil
+	}
+	at := time.Now()
+	if clockTime != "" {
+		at = time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, at.Location()).Add(parseClockTime(clockTime))
+	}
+	if startNumber == 0 {
+		return s.store.UnassignChip(chipID, at)
+	}
+	return s.store.AssignChip(chipID, startNumber, at)
+}
+
+// ChipsHandler responds with currently assigned chips from store
+func (s Service) ChipsHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		chips, err := s.store.FindChips()
+		if err != nil {
+			s.requestLogger(r).Errorln(err.Error())
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		jsonData, err := json.Marshal(chips.current())
+		if err != nil {
+			s.requestLogger(r).Errorln(err.Error())
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, jsonData, http.StatusOK)
+	}
+}
@@ -0,0 +1,177 @@
+package athletes
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// chipStoreMock records chip assignments, returns err if set
+type chipStoreMock struct {
+	storeMock
+	chips map[string]int
+	err   error
+}
+
+func (s *chipStoreMock) AssignChip(chipID string, startNumber int, at time.Time) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.chips[chipID] = startNumber
+	return nil
+}
+
+func (s *chipStoreMock) UnassignChip(chipID string, at time.Time) error {
+	if s.err != nil {
+		return s.err
+	}
+	delete(s.chips, chipID)
+	return nil
+}
+
+func TestChipReassignment(t *testing.T) {
+	store := &chipStoreMock{chips: map[string]int{}}
+	service := newTestService(t)
+	service.store = store
+	johnChip := "d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17"
+	spareChip := "aaaaaaaa-e63e-442c-98c4-1be4ac871367"
+
+	// Spare chip for John, both chips are read
+	_, _, err := service.AssignChip(spareChip, 1, false)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, map[string]int{spareChip: 1}, store.chips)
+	row, err := service.processTimingEvent(timingRequest{spareChip, "finish_corridor", "00:01:10", ""})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, row.StartNumber)
+	assert.Equal(t, johnChip, row.ChipID)
+	row, err = service.processTimingEvent(timingRequest{johnChip, "finish_line", "00:01:15", ""})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "00:01:10", row.FinishCorridor)
+	assert.Equal(t, "00:01:15", row.FinishLine)
+
+	// Assigning again is a no-op
+	_, _, err = service.AssignChip(spareChip, 1, false)
+	assert.Equal(t, nil, err)
+
+	// Spare chip is moved to Felicia mid-event
+	_, _, err = service.AssignChip(spareChip, 3, false)
+	assert.Equal(t, ChipAlreadyAssigned{spareChip, 1}, err)
+	row, _, err = service.AssignChip(spareChip, 3, true)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, row.StartNumber)
+	assert.Equal(t, "32f637d8-40f9-454e-b7b5-88734865cba2", row.ChipID)
+	assert.Equal(t, "", row.FinishCorridor)
+	assert.Equal(t, map[string]int{spareChip: 3}, store.chips)
+	row, err = service.processTimingEvent(timingRequest{spareChip, "finish_corridor", "00:01:20", ""})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, row.StartNumber)
+	row, err = service.leadeboard.Find(johnChip)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "00:01:10", row.FinishCorridor)
+
+	// Store failure keeps previous assignment
+	store.err = fmt.Errorf("connection lost")
+	_, _, err = service.AssignChip(spareChip, 1, true)
+	assert.Equal(t, store.err, err)
+	row, err = service.leadeboard.Find(spareChip)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, row.StartNumber)
+	_, err = service.UnassignChip(spareChip)
+	assert.Equal(t, store.err, err)
+	store.err = nil
+
+	// Unassigned chip is quarantined
+	row, err = service.UnassignChip(spareChip)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, row.StartNumber)
+	assert.Equal(t, map[string]int{}, store.chips)
+	_, err = service.UnassignChip(spareChip)
+	assert.Equal(t, AtheleteNotFound{spareChip}, err)
+	_, err = service.processTimingEvent(timingRequest{spareChip, "finish_line", "00:01:25", ""})
+	assert.Equal(t, ReadQuarantined{spareChip}, err)
+}
+
+func TestLeaderboardChips(t *testing.T) {
+	l, err := NewLeaderboard(&multiChipStoreMock{})
+	assert.Equal(t, nil, err)
+	spareChip := "aaaaaaaa-e63e-442c-98c4-1be4ac871367"
+
+	row, err := l.Find(spareChip)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, row.StartNumber)
+	assert.Equal(t, "e058c321-b904-46ac-a7fb-9bf0ffeb518e", row.ChipID)
+
+	// Unassigning the first chip keeps the spare one
+	row, err = l.UnassignChip("e058c321-b904-46ac-a7fb-9bf0ffeb518e", "")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, spareChip, row.ChipID)
+	_, err = l.Find("e058c321-b904-46ac-a7fb-9bf0ffeb518e")
+	assert.Equal(t, AtheleteNotFound{"e058c321-b904-46ac-a7fb-9bf0ffeb518e"}, err)
+
+	_, err = l.AssignChip(spareChip, 42, "")
+	assert.Equal(t, ChipAlreadyAssigned{spareChip, 2}, err)
+	_, err = l.AssignChip("bbbbbbbb-e63e-442c-98c4-1be4ac871367", 42, "")
+	assert.Equal(t, StartNumberNotFound{42}, err)
+}
+
+// multiChipStoreMock has a spare chip assigned to Jonah
+type multiChipStoreMock struct {
+	storeMock
+}
+
+func (multiChipStoreMock) FindChips() (Chips, error) {
+	return Chips{
+		Chip{ChipID: "e058c321-b904-46ac-a7fb-9bf0ffeb518e", StartNumber: 2},
+		Chip{ChipID: "aaaaaaaa-e63e-442c-98c4-1be4ac871367", StartNumber: 2},
+	}, nil
+}
+
+func TestChipPeriods(t *testing.T) {
+	l, err := NewLeaderboard(&historyStoreMock{})
+	assert.Equal(t, nil, err)
+	spareChip := "aaaaaaaa-e63e-442c-98c4-1be4ac871367"
+
+	// Chip was John's from 09:00 to 09:30 and is Jonah's since then
+	row, err := l.FindAndUpdate(spareChip, "finish_corridor", "09:20:00")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, row.StartNumber)
+	row, err = l.FindAndUpdate(spareChip, "finish_corridor", "09:40:00")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, row.StartNumber)
+
+	// Chip moved to Felicia at 10:00 keeps Jonah's reads before it
+	_, err = l.UnassignChip(spareChip, "10:00:00")
+	assert.Equal(t, nil, err)
+	_, err = l.AssignChip(spareChip, 3, "10:00:00")
+	assert.Equal(t, nil, err)
+	row, err = l.FindAt(spareChip, "09:45:00")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, row.StartNumber)
+	row, err = l.FindAt(spareChip, "10:00:00")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, row.StartNumber)
+
+	// Reads before the first assignment go to the current owner, like quarantined reads
+	row, err = l.FindAt(spareChip, "08:00:00")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, row.StartNumber)
+}
+
+// historyStoreMock has a spare chip assigned to John from 09:00 to 09:30 and to Jonah since then
+type historyStoreMock struct {
+	storeMock
+}
+
+func (historyStoreMock) FindChips() (Chips, error) {
+	at := func(clock string) time.Time {
+		now := time.Now()
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).Add(parseClockTime(clock))
+	}
+	validTo := at("09:30:00")
+	return Chips{
+		Chip{ChipID: "aaaaaaaa-e63e-442c-98c4-1be4ac871367", StartNumber: 1, ValidFrom: at("09:00:00"), ValidTo: &validTo},
+		Chip{ChipID: "aaaaaaaa-e63e-442c-98c4-1be4ac871367", StartNumber: 2, ValidFrom: at("09:30:00")},
+	}, nil
+}
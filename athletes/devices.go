@@ -0,0 +1,167 @@
+package athletes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"gitlab.com/mooncascade/event-timing-server/devices"
+)
+
+type registerDeviceRequest struct {
+	DeviceID      string `json:"device_id" validate:"required,max=64"`
+	TimingPointID string `json:"timing_point_id" validate:"required,oneof='finish_corridor' 'finish_line'"`
+}
+
+type syncRequest struct {
+	ClockTime   string `json:"clock_time" validate:"required,datetime=15:04:05.999"`
+	RoundTripMS int64  `json:"round_trip_ms" validate:"min=0,max=60000"`
+}
+
+// SyncResponse contains synchronized device and server clock time
+// at the moment sync request was received
+type SyncResponse struct {
+	devices.Device
+	ServerClockTime string `json:"server_clock_time"`
+}
+
+// DeviceAlert is sent to ws clients when device status changes during an active race
+type DeviceAlert struct {
+	Type   string         `json:"type"`
+	Device devices.Device `json:"device"`
+}
+
+// RegisterDeviceHandler registers timing device and responds with devices.Device
+func (s Service) RegisterDeviceHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		deviceData := registerDeviceRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&deviceData); err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.Validate(deviceData); err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		device := s.devices.Register(deviceData.DeviceID, deviceData.TimingPointID)
+		s.requestLogger(r).Infof("Device %s: registered at %s", device.ID, device.TimingPointID)
+		s.writeDevice(w, device)
+	}
+}
+
+// DeviceHeartbeatHandler marks device as seen and responds with devices.Device.
+// Request body is ignored, clock offset is measured only by DeviceSyncHandler as
+// heartbeats do not compensate request latency
+func (s Service) DeviceHeartbeatHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		device, err := s.devices.Heartbeat(chi.URLParam(r, "deviceID"), nil)
+		if errors.As(err, &devices.DeviceNotFound{}) {
+			writeError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		s.writeDevice(w, device)
+	}
+}
+
+// DeviceSyncHandler is a clock sync handshake. Device sends its clock time and
+// optionally round trip time of the previous sync request. Clock offset is measured
+// as difference between server time and device time at the moment request was received,
+// half of round trip is used as an estimate of request latency. Clock times of
+// timing events from the device are corrected by measured offset. Responds with SyncResponse
+func (s Service) DeviceSyncHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		syncData := syncRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&syncData); err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.Validate(syncData); err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		offset, err := devices.MeasureClockOffset(syncData.ClockTime, now)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		offset -= time.Duration(syncData.RoundTripMS) * time.Millisecond / 2
+		device, err := s.devices.Heartbeat(chi.URLParam(r, "deviceID"), &offset)
+		if errors.As(err, &devices.DeviceNotFound{}) {
+			writeError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		s.requestLogger(r).Infof("Device %s: clock offset %v", device.ID, device.ClockOffset())
+
+		jsonData, err := json.Marshal(SyncResponse{device, now.Format("15:04:05.999")})
+		if err != nil {
+			s.requestLogger(r).Errorln(err.Error())
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, jsonData, http.StatusOK)
+	}
+}
+
+// DevicesHandler responds with status of all registered devices
+func (s Service) DevicesHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jsonData, err := json.Marshal(s.devices.All())
+		if err != nil {
+			s.requestLogger(r).Errorln(err.Error())
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, jsonData, http.StatusOK)
+	}
+}
+
+// MonitorDevices checks device statuses every second until ctx is done, see checkDevices
+func (s Service) MonitorDevices(ctx context.Context, timeout time.Duration) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.checkDevices(timeout)
+		}
+	}
+}
+
+// checkDevices marks devices with heartbeat which did not report for longer than timeout as silent.
+// When race is started, every status change is sent as DeviceAlert to all connected ws clients
+func (s Service) checkDevices(timeout time.Duration) {
+	changed := s.devices.Check(timeout)
+	if len(changed) == 0 {
+		return
+	}
+	active := s.race.get().State == RaceStarted
+	for _, device := range changed {
+		s.logger.Warnf("Device %s: %s", device.ID, device.Status)
+		if !active {
+			continue
+		}
+		jsonData, err := json.Marshal(DeviceAlert{"device_" + device.Status, device})
+		if err != nil {
+			s.logger.Errorln(err.Error())
+			continue
+		}
+		s.wsManager.SendMessageToAll(jsonData)
+	}
+}
+
+func (s Service) writeDevice(w http.ResponseWriter, device devices.Device) {
+	jsonData, err := json.Marshal(device)
+	if err != nil {
+		s.logger.Errorln(err.Error())
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, jsonData, http.StatusOK)
+}
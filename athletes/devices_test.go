@@ -0,0 +1,96 @@
+package athletes
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClockOffsetCorrection(t *testing.T) {
+	service := newTestService(t)
+	offset := 1500 * time.Millisecond
+	service.devices.Register("mat-1", "finish_line")
+	service.devices.Heartbeat("mat-1", &offset)
+
+	var john = LeaderboardRow{Athlete: Athlete{"John", "Doe", "d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", 1, ""}, Timings: Timings{}}
+	john.FinishLine = "00:01:11.623"
+	john.FinishLineRaw = "00:01:10.123"
+	john.Flags = []string{FlagMissingFinishCorridor}
+	row, err := service.processTimingEvent(timingRequest{john.ChipID, "finish_line", "00:01:10.123", "mat-1"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, john, row)
+
+	// Device without offset
+	john.FinishCorridor = "00:01:05"
+	john.Flags = nil
+	row, err = service.processTimingEvent(timingRequest{john.ChipID, "finish_corridor", "00:01:05", "mat-2"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, john, row)
+
+	// No device, raw time is cleared
+	john.FinishLine = "00:01:12"
+	john.FinishLineRaw = ""
+	row, err = service.processTimingEvent(timingRequest{john.ChipID, "finish_line", "00:01:12", ""})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, john, row)
+
+	devices := service.devices.All()
+	assert.Equal(t, 1, devices[0].Reads)
+	assert.Equal(t, 1, devices[1].Reads)
+}
+
+func TestDeviceHeartbeat(t *testing.T) {
+	service := newTestService(t)
+	r := chi.NewRouter()
+	r.Post("/devices/{deviceID}/heartbeat", service.DeviceHeartbeatHandler())
+	offset := 1500 * time.Millisecond
+	service.devices.Register("mat-1", "finish_line")
+	service.devices.Heartbeat("mat-1", &offset)
+
+	// Clock time sent by older devices does not replace offset measured by sync
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/devices/mat-1/heartbeat", strings.NewReader(`{"clock_time":"00:00:00"}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, offset, service.devices.All()[0].ClockOffset())
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/devices/mat-2/heartbeat", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestMonitorDevices(t *testing.T) {
+	service := newTestService(t)
+	service.devices.Register("mat-1", "finish_line")
+	service.devices.Heartbeat("mat-1", nil)
+	_, err := service.processTimingEvent(timingRequest{"d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", "finish_line", "00:01:10", "decoder-1"})
+	assert.Equal(t, nil, err)
+
+	// Only device which sent a heartbeat goes silent
+	time.Sleep(10 * time.Millisecond)
+	service.checkDevices(time.Millisecond)
+	devices := service.devices.All()
+	assert.Equal(t, "decoder-1", devices[0].ID)
+	assert.Equal(t, "online", devices[0].Status)
+	assert.Equal(t, "mat-1", devices[1].ID)
+	assert.Equal(t, "silent", devices[1].Status)
+
+	// Monitor stops with its context
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		service.MonitorDevices(ctx, time.Second)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("monitor not stopped")
+	}
+}
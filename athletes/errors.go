@@ -10,3 +10,79 @@ type AtheleteNotFound struct {
 func (a AtheleteNotFound) Error() string {
 	return fmt.Sprintf("athlete with chipId: %s not found", a.ChipID)
 }
+
+// InvalidTimingEvent .
+type InvalidTimingEvent struct {
+	Err error
+}
+
+func (i InvalidTimingEvent) Error() string {
+	return i.Err.Error()
+}
+
+// ReadQuarantined .
+type ReadQuarantined struct {
+	ChipID string
+}
+
+func (r ReadQuarantined) Error() string {
+	return fmt.Sprintf("athlete with chipId: %s not found, read is quarantined", r.ChipID)
+}
+
+// StartNumberNotFound .
+type StartNumberNotFound struct {
+	StartNumber int
+}
+
+func (s StartNumberNotFound) Error() string {
+	return fmt.Sprintf("athlete with startNumber: %d not found", s.StartNumber)
+}
+
+// ChipAlreadyAssigned .
+type ChipAlreadyAssigned struct {
+	ChipID      string
+	StartNumber int
+}
+
+func (c ChipAlreadyAssigned) Error() string {
+	return fmt.Sprintf("chipId: %s is already assigned to athlete with startNumber: %d", c.ChipID, c.StartNumber)
+}
+
+// InvalidRaceTransition .
+type InvalidRaceTransition struct {
+	Action string
+	State  string
+}
+
+func (i InvalidRaceTransition) Error() string {
+	return fmt.Sprintf("action %s is not allowed when race is %s", i.Action, i.State)
+}
+
+// RaceNotOpen .
+type RaceNotOpen struct {
+	State string
+}
+
+func (r RaceNotOpen) Error() string {
+	return fmt.Sprintf("race is %s, timing events are not accepted", r.State)
+}
+
+// WaveNotFound .
+type WaveNotFound struct {
+	Wave string
+}
+
+func (w WaveNotFound) Error() string {
+	return fmt.Sprintf("wave %s not found", w.Wave)
+}
+
+// LapNotCounted .
+type LapNotCounted struct {
+	ChipID    string
+	ClockTime string
+	Reason    string
+}
+
+func (l LapNotCounted) Error() string {
+	return fmt.Sprintf("read of chipId: %s at %s is not counted as lap: %s", l.ChipID, l.ClockTime, l.Reason)
+}
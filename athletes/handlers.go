@@ -4,17 +4,28 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/sirupsen/logrus"
+	"gitlab.com/mooncascade/event-timing-server/devices"
+	"gitlab.com/mooncascade/event-timing-server/lineprotocol"
+	"gitlab.com/mooncascade/event-timing-server/metrics"
 )
 
 type timingRequest struct {
 	ChipID        string `json:"chip_id" validate:"required,uuid4"`
 	TimingPointID string `json:"timing_point_id" validate:"required,oneof='finish_corridor' 'finish_line'"`
 	ClockTime     string `json:"clock_time" validate:"required,datetime=15:04:05.999"`
+	DeviceID      string `json:"device_id" validate:"omitempty,max=64"`
 }
 
-// ErrorResponse .
+// ErrorResponse . RequestID is taken from X-Request-Id response header set by router
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error     string `json:"error"`
+	RequestID string `json:"request_id,omitempty"`
 }
 
 // SuccessResponse .
@@ -22,9 +33,10 @@ type SuccessResponse struct {
 	Message string `json:"message"`
 }
 
-// ReceiveTimingEventHandler receives timingRequest, does validation, calls
-// Leaderboard.FindAndUpdate, responds with success message and lastly calls
-// WSManager.SendMessageToAll notifying all connected ws clients about update
+// ReceiveTimingEventHandler receives timingRequest, passes it to processTimingEvent
+// and responds with success message. Reads of unknown chips are quarantined and
+// responded with 202 status, timing events outside of race are responded with 409 status.
+// finish_line crossings of LapRace which are not counted as lap, e.g. double reads, are ignored
 func (s Service) ReceiveTimingEventHandler() func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		timingData := timingRequest{}
@@ -33,33 +45,247 @@ func (s Service) ReceiveTimingEventHandler() func(w http.ResponseWriter, r *http
 			writeError(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		if err := s.Validate(timingData); err != nil {
+
+		_, err = s.processTimingEvent(timingData)
+		if errors.As(err, &InvalidTimingEvent{}) {
 			writeError(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-
-		updatedRow, err := s.leadeboard.FindAndUpdate(timingData.ChipID, timingData.TimingPointID, timingData.ClockTime)
-		if errors.As(err, &AtheleteNotFound{}) {
-			writeError(w, err.Error(), http.StatusNotFound)
+		if errors.As(err, &ReadQuarantined{}) {
+			jsonData, _ := json.Marshal(SuccessResponse{"quarantined"})
+			writeJSON(w, jsonData, http.StatusAccepted)
+			return
+		}
+		if errors.As(err, &RaceNotOpen{}) {
+			writeError(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if errors.As(err, &LapNotCounted{}) {
+			writeSuccess(w, "not counted")
+			return
+		}
+		if err != nil {
+			s.requestLogger(r).Errorln(err.Error())
+			writeError(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
 		writeSuccess(w, "updated")
-		jsonData, err := json.Marshal(updatedRow)
+	}
+}
+
+// LineProtocolHandler returns lineprotocol.Handler which passes timing events
+// received from decoders over TCP to processTimingEvent
+func (s Service) LineProtocolHandler() lineprotocol.Handler {
+	return func(e lineprotocol.Event) error {
+		_, err := s.processTimingEvent(timingRequest{e.ChipID, e.TimingPointID, e.ClockTime, e.DeviceID})
+		if errors.As(err, &ReadQuarantined{}) || errors.As(err, &LapNotCounted{}) {
+			return nil
+		}
+		return err
+	}
+}
+
+// processTimingEvent does validation, checks that race accepts timing events, see race.open,
+// records read of the device if DeviceID is set
+// and corrects clock time by device clock offset, calls Leaderboard.FindAndUpdateCorrected
+// and calls WSManager.SendMessageToAll notifying all connected ws clients about update.
+// Reads of unknown chips are quarantined and ReadQuarantined error is returned.
+// Applied and quarantined events are published to other instances of the cluster.
+// Result of every event is counted in metrics.TimingEvents
+func (s Service) processTimingEvent(timingData timingRequest) (row LeaderboardRow, err error) {
+	return s.processRead(timingData, false)
+}
+
+// processRead is processTimingEvent which also accepts timing events of finished race if late is set
+func (s Service) processRead(timingData timingRequest, late bool) (row LeaderboardRow, err error) {
+	defer func() { countTimingEvent(timingData.TimingPointID, err) }()
+	if err := s.Validate(timingData); err != nil {
+		return LeaderboardRow{}, InvalidTimingEvent{err}
+	}
+	race, started, err := s.race.open(late)
+	if err != nil {
+		return LeaderboardRow{}, err
+	}
+	if started {
+		s.raceChanged(race)
+	}
+	clockTime := timingData.ClockTime
+	if timingData.DeviceID != "" {
+		device := s.devices.RecordRead(timingData.DeviceID, timingData.TimingPointID)
+		corrected, err := devices.CorrectClockTime(clockTime, device.ClockOffset())
+		if err != nil {
+			return LeaderboardRow{}, InvalidTimingEvent{err}
+		}
+		clockTime = corrected
+	}
+
+	updatedRow, err := s.leadeboard.FindAndUpdateCorrected(timingData.ChipID, timingData.TimingPointID, clockTime, timingData.ClockTime)
+	if errors.As(err, &AtheleteNotFound{}) {
+		s.unmatched.add(UnmatchedRead{
+			ChipID:        timingData.ChipID,
+			TimingPointID: timingData.TimingPointID,
+			ClockTime:     clockTime,
+			RawClockTime:  timingData.ClockTime,
+			DeviceID:      timingData.DeviceID,
+			ReceivedAt:    time.Now(),
+		})
+		s.publishTiming(timingData, clockTime)
+		return updatedRow, ReadQuarantined{timingData.ChipID}
+	}
+	if err != nil {
+		return updatedRow, err
+	}
+
+	s.publishTiming(timingData, clockTime)
+	s.broadcastRow(updatedRow)
+	return updatedRow, nil
+}
+
+// publishTiming publishes timing event with corrected clockTime to other instances
+func (s Service) publishTiming(timingData timingRequest, clockTime string) {
+	s.publish(replicatedEvent{
+		Kind:          replicatedTiming,
+		ChipID:        timingData.ChipID,
+		TimingPointID: timingData.TimingPointID,
+		ClockTime:     clockTime,
+		RawClockTime:  timingData.ClockTime,
+		DeviceID:      timingData.DeviceID,
+	})
+}
+
+// countTimingEvent counts timing event in metrics.TimingEvents by result of processTimingEvent
+func countTimingEvent(timingPointID string, err error) {
+	result, reason := metrics.ResultAccepted, ""
+	switch {
+	case err == nil:
+	case errors.As(err, &ReadQuarantined{}):
+		result, reason = metrics.ResultQuarantined, "unknown_chip"
+	case errors.As(err, &InvalidTimingEvent{}):
+		result, reason = metrics.ResultRejected, "invalid"
+	case errors.As(err, &RaceNotOpen{}):
+		result, reason = metrics.ResultRejected, "race_not_open"
+	case errors.As(err, &LapNotCounted{}):
+		result, reason = metrics.ResultRejected, "lap_not_counted"
+	default:
+		result, reason = metrics.ResultRejected, "internal"
+	}
+	metrics.TimingEvents.WithLabelValues(result, reason, metrics.TimingPoint(timingPointID)).Inc()
+}
+
+// broadcastRow notifies all connected ws clients about updated row
+// and clients following the athlete about its new AthleteStatus
+func (s Service) broadcastRow(row LeaderboardRow) {
+	jsonData, err := json.Marshal(row)
+	if err != nil {
+		s.logger.Errorln(err.Error())
+		return
+	}
+	s.wsManager.SendMessageToAll(jsonData)
+	s.sendAthleteStatus(row)
+}
+
+// ReplayHandler reads timing log file from request body, passes it to Service.Replay
+// and responds with ReplayReport. Line format is taken from format, delimiter and
+// points query parameters, defaults to lineprotocol.DefaultFormat
+func (s Service) ReplayHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		fields := strings.Join(lineprotocol.DefaultFormat.Fields, ",")
+		if query.Get("format") != "" {
+			fields = query.Get("format")
+		}
+		delimiter := lineprotocol.DefaultFormat.Delimiter
+		if _, ok := query["delimiter"]; ok {
+			delimiter = query.Get("delimiter")
+		}
+		format, err := lineprotocol.ParseFormat(fields, delimiter, query.Get("points"))
 		if err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		report, err := s.Replay(r.Body, format)
+		if errors.As(err, &RaceNotOpen{}) {
+			writeError(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			s.requestLogger(r).Errorln(err.Error())
 			writeError(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		s.wsManager.SendMessageToAll(jsonData)
+		jsonData, err := json.Marshal(report)
+		if err != nil {
+			s.requestLogger(r).Errorln(err.Error())
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, jsonData, http.StatusOK)
 	}
 }
 
-// LeaderboardHandler respons with a sorted array of LeaderboardRows
+// LeaderboardHandler respons with a sorted array of LeaderboardRows.
+// Rows can be filtered and paginated by query parameters, see leaderboardQuery.
+// Number of filtered rows and offset of the first returned row are sent in
+// X-Total-Count and X-Offset headers, state of Race in X-Race-State header.
+// Responds with 304 status if leaderboard was not changed since the version
+// in If-None-Match header, see notModified
 func (s Service) LeaderboardHandler() func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		jsonData, err := json.Marshal(s.leadeboard.CurrentState())
+		query, err := parseLeaderboardQuery(r.URL.Query())
+		if err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		snapshot, version := s.leadeboard.Snapshot()
+		rows, total, offset, err := query.apply(snapshot)
+		if errors.As(err, &StartNumberNotFound{}) {
+			writeError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if notModified(w, r, version) {
+			return
+		}
+		jsonData, err := json.Marshal(rows)
+		if err != nil {
+			s.requestLogger(r).Errorln(err.Error())
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		w.Header().Set("X-Offset", strconv.Itoa(offset))
+		w.Header().Set("X-Race-State", s.race.get().State)
+		writeJSON(w, jsonData, http.StatusOK)
+	}
+}
+
+// UnmatchedReadsHandler responds with quarantined reads of unknown chips
+func (s Service) UnmatchedReadsHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jsonData, err := json.Marshal(s.unmatched.all())
+		if err != nil {
+			s.requestLogger(r).Errorln(err.Error())
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, jsonData, http.StatusOK)
+	}
+}
+
+// AnomaliesHandler responds with LeaderboardRows which break consistency Rules
+// in leaderboard order
+func (s Service) AnomaliesHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		anomalies := []LeaderboardRow{}
+		for _, row := range s.leadeboard.CurrentState() {
+			if len(row.Flags) > 0 {
+				anomalies = append(anomalies, row)
+			}
+		}
+		jsonData, err := json.Marshal(anomalies)
 		if err != nil {
-			s.logger.Errorln(err.Error())
+			s.requestLogger(r).Errorln(err.Error())
 			writeError(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -68,18 +294,28 @@ func (s Service) LeaderboardHandler() func(w http.ResponseWriter, r *http.Reques
 }
 
 // WSHandler handles websocket connection, adds new client by calling WSManager.AddCLient,
-// sends current leaderboard as first message to client and lastly calls WSManager.StartClient
+// sends current leaderboard as first message to client and lastly calls WSManager.StartClient.
+// With bib query parameter, client follows only one athlete, see Service.trackAthlete
 func (s Service) WSHandler() func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if bib := r.URL.Query().Get("bib"); bib != "" {
+			startNumber, err := parseStartNumber(bib)
+			if err != nil {
+				writeError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			s.trackAthlete(w, r, startNumber)
+			return
+		}
 		ws, err := s.wsManager.Upgrade(w, r, nil)
 		if err != nil {
-			s.logger.Errorln(err.Error())
+			s.requestLogger(r).Errorln(err.Error())
 			return
 		}
-		clientID := s.wsManager.AddClient(ws, s.logger)
+		clientID := s.wsManager.AddClient(ws, s.wsLogger)
 		jsonData, err := json.Marshal(s.leadeboard.CurrentState())
 		if err != nil {
-			s.logger.Errorln(err.Error())
+			s.requestLogger(r).Errorln(err.Error())
 			return
 		}
 		go s.wsManager.SendMessageToOne(jsonData, clientID)
@@ -87,8 +323,13 @@ func (s Service) WSHandler() func(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// requestLogger returns logger of the Service with request_id field of request r
+func (s Service) requestLogger(r *http.Request) *logrus.Entry {
+	return s.logger.WithField("request_id", middleware.GetReqID(r.Context()))
+}
+
 func writeError(w http.ResponseWriter, err string, code int) {
-	jsonData, _ := json.Marshal(ErrorResponse{err})
+	jsonData, _ := json.Marshal(ErrorResponse{err, w.Header().Get(middleware.RequestIDHeader)})
 	writeJSON(w, jsonData, code)
 }
 
@@ -0,0 +1,27 @@
+package athletes
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/mooncascade/event-timing-server/metrics"
+)
+
+func TestTimingEventMetrics(t *testing.T) {
+	service := newTestService(t)
+	accepted := metrics.TimingEvents.WithLabelValues(metrics.ResultAccepted, "", "finish_line")
+	quarantined := metrics.TimingEvents.WithLabelValues(metrics.ResultQuarantined, "unknown_chip", "finish_corridor")
+	invalid := metrics.TimingEvents.WithLabelValues(metrics.ResultRejected, "invalid", "unknown")
+	before := []float64{testutil.ToFloat64(accepted), testutil.ToFloat64(quarantined), testutil.ToFloat64(invalid)}
+
+	service.processTimingEvent(timingRequest{"d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", "finish_line", "00:01:10", ""})
+	service.processTimingEvent(timingRequest{"e058c321-b904-46ac-a7fb-9bf0ffeb518e", "finish_line", "00:01:11", ""})
+	service.processTimingEvent(timingRequest{"aaaaaaaa-e63e-442c-98c4-1be4ac871367", "finish_corridor", "00:01:12", ""})
+	service.processTimingEvent(timingRequest{"d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", "start", "00:01:13", ""})
+
+	assert.Equal(t, before[0]+2, testutil.ToFloat64(accepted))
+	assert.Equal(t, before[1]+1, testutil.ToFloat64(quarantined))
+	assert.Equal(t, before[2]+1, testutil.ToFloat64(invalid))
+	assert.Equal(t, float64(4), testutil.ToFloat64(metrics.LeaderboardSize))
+}
@@ -0,0 +1,101 @@
+package athletes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Statuses of readiness checks
+const (
+	CheckOK     = "ok"
+	CheckFailed = "failed"
+)
+
+// ReadinessCheck is the result of one dependency check
+type ReadinessCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ReadinessResponse contains results of all dependency checks. Ready is true
+// only if all checks passed
+type ReadinessResponse struct {
+	Ready  bool                      `json:"ready"`
+	Checks map[string]ReadinessCheck `json:"checks"`
+}
+
+// Readiness checks that database is reachable, migrations are at expected version
+// and leaderboard is loaded. In cluster mode also checks that instance is synced
+// with other instances
+func (s Service) Readiness() ReadinessResponse {
+	checks := map[string]ReadinessCheck{
+		"database":    toReadinessCheck(s.store.Ping()),
+		"migrations":  toReadinessCheck(s.checkSchemaVersion()),
+		"leaderboard": toReadinessCheck(s.checkLeaderboard()),
+	}
+	if s.cluster != nil {
+		checks["cluster"] = toReadinessCheck(s.checkCluster())
+	}
+	ready := true
+	for _, check := range checks {
+		if check.Status != CheckOK {
+			ready = false
+		}
+	}
+	return ReadinessResponse{ready, checks}
+}
+
+func (s Service) checkSchemaVersion() error {
+	applied, dirty, err := s.store.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("migration %d failed", applied)
+	}
+	if applied != version {
+		return fmt.Errorf("expected version %d, got %d", version, applied)
+	}
+	return nil
+}
+
+func (s Service) checkLeaderboard() error {
+	if s.leadeboard == nil || len(s.leadeboard.CurrentState()) == 0 {
+		return fmt.Errorf("leaderboard is empty")
+	}
+	return nil
+}
+
+func toReadinessCheck(err error) ReadinessCheck {
+	if err != nil {
+		return ReadinessCheck{CheckFailed, err.Error()}
+	}
+	return ReadinessCheck{Status: CheckOK}
+}
+
+// HealthzHandler is a liveness probe, responds with success message while server is running
+func (s Service) HealthzHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeSuccess(w, "ok")
+	}
+}
+
+// ReadyzHandler is a readiness probe, responds with ReadinessResponse
+// and 503 status if any check failed
+func (s Service) ReadyzHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		readiness := s.Readiness()
+		jsonData, err := json.Marshal(readiness)
+		if err != nil {
+			s.requestLogger(r).Errorln(err.Error())
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		code := http.StatusOK
+		if !readiness.Ready {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, jsonData, code)
+	}
+}
@@ -0,0 +1,50 @@
+package athletes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// unhealthyStoreMock has unreachable db and failed migration
+type unhealthyStoreMock struct {
+	storeMock
+}
+
+func (unhealthyStoreMock) Ping() error { return fmt.Errorf("connection refused") }
+func (unhealthyStoreMock) SchemaVersion() (uint, bool, error) {
+	return version, true, nil
+}
+
+func TestReadiness(t *testing.T) {
+	service := newTestService(t)
+	w := httptest.NewRecorder()
+	service.ReadyzHandler()(w, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var readiness ReadinessResponse
+	assert.Equal(t, nil, json.Unmarshal(w.Body.Bytes(), &readiness))
+	assert.Equal(t, ReadinessResponse{true, map[string]ReadinessCheck{
+		"database":    {Status: CheckOK},
+		"migrations":  {Status: CheckOK},
+		"leaderboard": {Status: CheckOK},
+	}}, readiness)
+
+	service.store = unhealthyStoreMock{}
+	w = httptest.NewRecorder()
+	service.ReadyzHandler()(w, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, nil, json.Unmarshal(w.Body.Bytes(), &readiness))
+	assert.Equal(t, ReadinessResponse{false, map[string]ReadinessCheck{
+		"database":    {CheckFailed, "connection refused"},
+		"migrations":  {CheckFailed, fmt.Sprintf("migration %d failed", version)},
+		"leaderboard": {Status: CheckOK},
+	}}, readiness)
+
+	w = httptest.NewRecorder()
+	service.HealthzHandler()(w, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
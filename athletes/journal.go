@@ -0,0 +1,108 @@
+package athletes
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// journal appends leaderboard changes to a file as JSON lines of replicatedEvent.
+// Every line is synced to disk before append returns
+type journal struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// openJournal opens journal file at path, creating it if it does not exist,
+// and returns events already written to it. Incomplete last line left by a crash is skipped
+func openJournal(path string) (*journal, []replicatedEvent, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	events, complete, err := readJournal(file)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	if !complete {
+		// Next event starts on a new line
+		if _, err := file.Write([]byte("\n")); err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+	}
+	return &journal{file: file}, events, nil
+}
+
+// readJournal reads events from r, invalid lines are skipped.
+// complete is false if r does not end with a new line
+func readJournal(r io.Reader) (events []replicatedEvent, complete bool, err error) {
+	reader := bufio.NewReader(r)
+	complete = true
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			complete = line[len(line)-1] == '\n'
+			event := replicatedEvent{}
+			if json.Unmarshal(line, &event) == nil {
+				events = append(events, event)
+			}
+		}
+		if err == io.EOF {
+			return events, complete, nil
+		}
+		if err != nil {
+			return events, complete, err
+		}
+	}
+}
+
+func (j *journal) append(event replicatedEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+func (j *journal) close() {
+	j.file.Close()
+}
+
+// OpenJournal applies leaderboard changes written to journal file at path and appends
+// further timing events and chip assignments to it, so that leaderboard is recovered
+// after restart. Recovered chip assignments are saved in private store too, so they are
+// kept by roster reload. Must be called before handlers of the Service are created
+func (s *Service) OpenJournal(path string) error {
+	j, events, err := openJournal(path)
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		if err := s.applyReplicatedEvent(event); err != nil {
+			s.logger.Warnf("Journal: skipping %s of chip %s: %v", event.Kind, event.ChipID, err)
+		}
+	}
+	s.logger.Infof("Journal: %d events applied from %s", len(events), path)
+	s.journal = j
+	return nil
+}
+
+// record appends event to journal if it is open, failures are only logged
+// as event is already applied
+func (s Service) record(event replicatedEvent) {
+	if s.journal == nil {
+		return
+	}
+	if err := s.journal.append(event); err != nil {
+		s.logger.Errorf("Journal: writing %s of chip %s: %v", event.Kind, event.ChipID, err)
+	}
+}
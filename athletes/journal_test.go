@@ -0,0 +1,115 @@
+package athletes
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func newJournalService(t *testing.T, path string) *Service {
+	store, err := NewMemoryStore(demoAthletes)
+	assert.Equal(t, nil, err)
+	service, err := NewService(logrus.New(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.SetAutoStart(true)
+	if err := service.OpenJournal(path); err != nil {
+		t.Fatal(err)
+	}
+	return service
+}
+
+func TestJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "event.journal")
+	johnChip := "d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17"
+	spareChip := "aaaaaaaa-e63e-442c-98c4-1be4ac871367"
+	unknownChip := "bbbbbbbb-e63e-442c-98c4-1be4ac871367"
+
+	service := newJournalService(t, path)
+	_, err := service.processTimingEvent(timingRequest{johnChip, "finish_corridor", "00:01:10", ""})
+	assert.Equal(t, nil, err)
+	_, err = service.processTimingEvent(timingRequest{spareChip, "finish_corridor", "00:01:11", ""})
+	assert.Equal(t, ReadQuarantined{spareChip}, err)
+	_, _, err = service.AssignChip(spareChip, 2, false)
+	assert.Equal(t, nil, err)
+	_, err = service.processTimingEvent(timingRequest{unknownChip, "finish_line", "00:01:12", ""})
+	assert.Equal(t, ReadQuarantined{unknownChip}, err)
+	_, err = service.processTimingEvent(timingRequest{johnChip, "finish_line", "1:15", ""})
+	assert.Equal(t, true, err != nil)
+	state := service.leadeboard.CurrentState()
+	service.Close()
+
+	// Leaderboard, quarantine and race state are recovered after restart
+	service = newJournalService(t, path)
+	assert.Equal(t, state, service.leadeboard.CurrentState())
+	assert.Equal(t, 1, len(service.unmatched.all()))
+	assert.Equal(t, RaceStarted, service.race.get().State)
+	row, err := service.leadeboard.Find(spareChip)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "00:01:11", row.FinishCorridor)
+	service.Close()
+
+	// Incomplete last line is skipped, further events are appended on a new line
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	assert.Equal(t, nil, err)
+	file.Write([]byte(`{"kind":"timing","chip_id":"e058c3`))
+	file.Close()
+	service = newJournalService(t, path)
+	assert.Equal(t, state, service.leadeboard.CurrentState())
+	_, err = service.processTimingEvent(timingRequest{johnChip, "finish_line", "00:01:15", ""})
+	assert.Equal(t, nil, err)
+	service.Close()
+	service = newJournalService(t, path)
+	row, err = service.leadeboard.Find(johnChip)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "00:01:15", row.FinishLine)
+	service.Close()
+
+	data, err := ioutil.ReadFile(path)
+	assert.Equal(t, nil, err)
+	events, complete, err := readJournal(bytes.NewReader(data))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, complete)
+	// Race started by the first timing event, 4 timing events and chip assignment
+	assert.Equal(t, 6, len(events))
+	assert.Equal(t, replicatedRace, events[0].Kind)
+}
+
+func TestJournalChipsAfterRosterReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "event.journal")
+	johnChip := "d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17"
+	spareChip := "aaaaaaaa-e63e-442c-98c4-1be4ac871367"
+
+	service := newJournalService(t, path)
+	_, _, err := service.AssignChip(spareChip, 2, false)
+	assert.Equal(t, nil, err)
+	_, err = service.UnassignChip(johnChip)
+	assert.Equal(t, nil, err)
+	service.Close()
+
+	// Recovered assignments are saved in store, so roster reload keeps them
+	service = newJournalService(t, path)
+	chips, err := service.store.FindChips()
+	assert.Equal(t, nil, err)
+	current := map[string]int{}
+	for _, c := range chips.current() {
+		current[c.ChipID] = c.StartNumber
+	}
+	assert.Equal(t, 2, current[spareChip])
+	assert.Equal(t, 0, current[johnChip])
+
+	_, err = service.ReloadRoster()
+	assert.Equal(t, nil, err)
+	row, err := service.leadeboard.Find(spareChip)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, row.StartNumber)
+	_, err = service.leadeboard.Find(johnChip)
+	assert.Equal(t, AtheleteNotFound{johnChip}, err)
+	service.Close()
+}
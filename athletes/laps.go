@@ -0,0 +1,111 @@
+package athletes
+
+import (
+	"sort"
+	"time"
+)
+
+// LapRace counts laps of track races and criteriums, where athletes cross finish_line
+// many times. Every finish_line crossing of enabled LapRace completes a lap, a repeated read
+// at clock time of a counted crossing is ignored. finish_corridor keeps the latest crossing,
+// older reads are ignored. finish_corridor is not required by Rules as tracks often have none.
+//
+// Laps is the number of laps of the race, crossings after the last lap are not counted.
+// Zero means no limit.
+//
+// MinLapTime rejects crossings closer than it to another crossing of the athlete or to
+// gun time of athlete's wave, e.g. repeated reads of a chip standing on the mat.
+type LapRace struct {
+	Enabled    bool
+	Laps       int
+	MinLapTime time.Duration
+}
+
+// LapSplit is a lap completed by athlete. LapTime is time since the previous crossing,
+// for the first lap since gun time of athlete's wave, empty if gun time is not known.
+// ClockTimeRaw is set only when clock time was corrected by device clock offset
+type LapSplit struct {
+	Lap          int    `json:"lap"`
+	ClockTime    string `json:"clock_time"`
+	LapTime      string `json:"lap_time,omitempty"`
+	ClockTimeRaw string `json:"clock_time_raw,omitempty"`
+}
+
+// Reasons of LapNotCounted
+const (
+	lapTooShort    = "within minimum lap time"
+	lapsCompleted  = "all laps completed"
+	lapBeforeStart = "before start"
+	corridorOlder  = "finish_corridor keeps the latest crossing"
+)
+
+// crossing is a counted finish_line crossing, at is clockTime as duration since midnight
+type crossing struct {
+	clockTime    string
+	rawClockTime string
+	at           time.Duration
+}
+
+// countLap returns laps of node with finish_line crossing added in chronological order, so
+// late reads are counted in place. Laps are returned unchanged if crossing is already
+// counted. Returns LapNotCounted if crossing is too close to another
+// crossing or to start, or if all laps are completed. Must be called with l.mu held
+func (l *leaderboard) countLap(node *rankNode, chipID, clockTime, rawClockTime string) ([]crossing, error) {
+	at := parseClockTime(clockTime)
+	if start, ok := l.start(node.row.Wave); ok {
+		if at < start {
+			return nil, LapNotCounted{chipID, clockTime, lapBeforeStart}
+		}
+		if at-start < l.lapRace.MinLapTime {
+			return nil, LapNotCounted{chipID, clockTime, lapTooShort}
+		}
+	}
+	i := sort.Search(len(node.laps), func(i int) bool { return node.laps[i].at >= at })
+	if i < len(node.laps) && node.laps[i].at == at {
+		return node.laps, nil
+	}
+	if i < len(node.laps) && node.laps[i].at-at < l.lapRace.MinLapTime {
+		return nil, LapNotCounted{chipID, clockTime, lapTooShort}
+	}
+	if i > 0 && at-node.laps[i-1].at < l.lapRace.MinLapTime {
+		return nil, LapNotCounted{chipID, clockTime, lapTooShort}
+	}
+	if l.lapRace.Laps > 0 && i >= l.lapRace.Laps {
+		return nil, LapNotCounted{chipID, clockTime, lapsCompleted}
+	}
+
+	laps := make([]crossing, 0, len(node.laps)+1)
+	laps = append(laps, node.laps[:i]...)
+	laps = append(laps, crossing{clockTime, rawClockTime, at})
+	laps = append(laps, node.laps[i:]...)
+	if l.lapRace.Laps > 0 && len(laps) > l.lapRace.Laps {
+		laps = laps[:l.lapRace.Laps]
+	}
+	return laps, nil
+}
+
+// lapSplits returns splits of counted crossings, nil if there are none.
+// Lap time of the first lap is set only if start is known
+func lapSplits(laps []crossing, start time.Duration, hasStart bool) []LapSplit {
+	if len(laps) == 0 {
+		return nil
+	}
+	splits := make([]LapSplit, 0, len(laps))
+	for i, c := range laps {
+		split := LapSplit{Lap: i + 1, ClockTime: c.clockTime, ClockTimeRaw: c.rawClockTime}
+		switch {
+		case i > 0:
+			split.LapTime = elapsedTime(c.clockTime, laps[i-1].at)
+		case hasStart:
+			split.LapTime = elapsedTime(c.clockTime, start)
+		}
+		splits = append(splits, split)
+	}
+	return splits
+}
+
+// SetLapRace sets lap counting of Leaderboard. Must be called before OpenJournal
+// and JoinCluster as laps of timing events are counted when they are applied
+func (s Service) SetLapRace(race LapRace) {
+	s.leadeboard.SetLapRace(race)
+}
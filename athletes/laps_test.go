@@ -0,0 +1,147 @@
+package athletes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/mooncascade/event-timing-server/lineprotocol"
+)
+
+func newLapService(t *testing.T) *Service {
+	service := newWavesService(t)
+	service.SetLapRace(LapRace{Enabled: true, Laps: 3, MinLapTime: time.Minute})
+	return service
+}
+
+func TestLapRace(t *testing.T) {
+	service := newLapService(t)
+	read := func(chipID, timingPointID, clockTime string) error {
+		_, err := service.processTimingEvent(timingRequest{chipID, timingPointID, clockTime, ""})
+		return err
+	}
+	john := "d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17"
+	assert.Equal(t, LapNotCounted{john, "08:59:00", lapBeforeStart}, read(john, "finish_line", "08:59:00"))
+	assert.Equal(t, LapNotCounted{john, "09:00:30", lapTooShort}, read(john, "finish_line", "09:00:30"))
+	assert.Equal(t, nil, read(john, "finish_line", "09:10:00"))
+	assert.Equal(t, LapNotCounted{john, "09:10:20", lapTooShort}, read(john, "finish_line", "09:10:20"))
+	// Repeated read of counted crossing is ignored
+	assert.Equal(t, nil, read(john, "finish_line", "09:10:00"))
+	assert.Equal(t, nil, read(john, "finish_line", "09:20:00"))
+	// Late read is counted in place
+	assert.Equal(t, nil, read(john, "finish_line", "09:15:00"))
+	assert.Equal(t, LapNotCounted{john, "09:25:00", lapsCompleted}, read(john, "finish_line", "09:25:00"))
+
+	row, err := service.leadeboard.Find(john)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, row.Laps)
+	assert.Equal(t, []LapSplit{{1, "09:10:00", "00:10:00", ""}, {2, "09:15:00", "00:05:00", ""}, {3, "09:20:00", "00:05:00", ""}}, row.LapSplits)
+	assert.Equal(t, "09:20:00", row.FinishLine)
+	assert.Equal(t, "00:20:00", row.Elapsed)
+	// finish_corridor is not required
+	assert.Equal(t, []string(nil), row.Flags)
+
+	// Wave B has no gun time, its first lap has no lap time
+	assert.Equal(t, nil, read("e058c321-b904-46ac-a7fb-9bf0ffeb518e", "finish_corridor", "09:11:50"))
+	// Older finish_corridor read does not replace the latest crossing
+	assert.Equal(t, LapNotCounted{"e058c321-b904-46ac-a7fb-9bf0ffeb518e", "09:05:00", corridorOlder},
+		read("e058c321-b904-46ac-a7fb-9bf0ffeb518e", "finish_corridor", "09:05:00"))
+	assert.Equal(t, nil, read("e058c321-b904-46ac-a7fb-9bf0ffeb518e", "finish_line", "09:12:00"))
+	assert.Equal(t, nil, read("32f637d8-40f9-454e-b7b5-88734865cba2", "finish_line", "09:11:00"))
+	assert.Equal(t, nil, read("32f637d8-40f9-454e-b7b5-88734865cba2", "finish_line", "09:21:00"))
+	row, _ = service.leadeboard.Find("e058c321-b904-46ac-a7fb-9bf0ffeb518e")
+	assert.Equal(t, []LapSplit{{1, "09:12:00", "", ""}}, row.LapSplits)
+	assert.Equal(t, "09:11:50", row.FinishCorridor)
+
+	// Athletes with more laps go first
+	startNumbers := []int{}
+	for _, row := range service.leadeboard.CurrentState() {
+		startNumbers = append(startNumbers, row.StartNumber)
+	}
+	assert.Equal(t, []int{1, 3, 2}, startNumbers)
+
+	// Lap times follow gun time of wave
+	_, err = service.StartWave("B", "09:02:00")
+	assert.Equal(t, nil, err)
+	row, _ = service.leadeboard.Find("e058c321-b904-46ac-a7fb-9bf0ffeb518e")
+	assert.Equal(t, []LapSplit{{1, "09:12:00", "00:10:00", ""}}, row.LapSplits)
+}
+
+func TestLapRaceReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "event.journal")
+	service := newLapService(t)
+	if err := service.OpenJournal(path); err != nil {
+		t.Fatal(err)
+	}
+	r := service.ReceiveTimingEventHandler()
+	update := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r(w, httptest.NewRequest("POST", "/update", strings.NewReader(body)))
+		return w
+	}
+	assert.Equal(t, http.StatusOK, update(`{"chip_id":"32f637d8-40f9-454e-b7b5-88734865cba2","timing_point_id":"finish_line","clock_time":"09:11:00"}`).Code)
+	w := update(`{"chip_id":"32f637d8-40f9-454e-b7b5-88734865cba2","timing_point_id":"finish_line","clock_time":"09:11:05"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	response := SuccessResponse{}
+	assert.Equal(t, nil, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "not counted", response.Message)
+	// Older finish_corridor read is not counted and not written to journal
+	assert.Equal(t, http.StatusOK, update(`{"chip_id":"32f637d8-40f9-454e-b7b5-88734865cba2","timing_point_id":"finish_corridor","clock_time":"09:10:50"}`).Code)
+	w = update(`{"chip_id":"32f637d8-40f9-454e-b7b5-88734865cba2","timing_point_id":"finish_corridor","clock_time":"09:05:00"}`)
+	assert.Equal(t, nil, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "not counted", response.Message)
+
+	log := `32f637d8-40f9-454e-b7b5-88734865cba2,finish_line,09:11:00.000
+32f637d8-40f9-454e-b7b5-88734865cba2,finish_line,09:11:00.000
+32f637d8-40f9-454e-b7b5-88734865cba2,finish_line,09:11:02
+32f637d8-40f9-454e-b7b5-88734865cba2,finish_line,09:21:00
+`
+	report, err := service.Replay(strings.NewReader(log), lineprotocol.DefaultFormat)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, report.Matched)
+	assert.Equal(t, 2, report.Duplicates)
+	assert.Equal(t, 1, len(report.Missing))
+	assert.Equal(t, 0, len(report.Different))
+	row, _ := service.leadeboard.Find("32f637d8-40f9-454e-b7b5-88734865cba2")
+	assert.Equal(t, 2, row.Laps)
+	service.Close()
+
+	// Laps are recovered from journal after restart
+	service = newLapService(t)
+	if err := service.OpenJournal(path); err != nil {
+		t.Fatal(err)
+	}
+	row, _ = service.leadeboard.Find("32f637d8-40f9-454e-b7b5-88734865cba2")
+	assert.Equal(t, []LapSplit{{1, "09:11:00", "", ""}, {2, "09:21:00", "00:10:00", ""}}, row.LapSplits)
+	assert.Equal(t, "09:10:50", row.FinishCorridor)
+	service.Close()
+
+	file, err := os.Open(path)
+	assert.Equal(t, nil, err)
+	defer file.Close()
+	events, _, err := readJournal(file)
+	assert.Equal(t, nil, err)
+	for _, event := range events {
+		assert.NotEqual(t, "09:05:00", event.ClockTime)
+	}
+}
+
+func TestLapRaceWithoutMinLapTime(t *testing.T) {
+	service := newWavesService(t)
+	service.SetLapRace(LapRace{Enabled: true})
+	john := "d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17"
+	for _, clockTime := range []string{"09:10:00", "09:10:00", "09:10:00.001"} {
+		_, err := service.processTimingEvent(timingRequest{john, "finish_line", clockTime, ""})
+		assert.Equal(t, nil, err)
+	}
+	row, _ := service.leadeboard.Find(john)
+	assert.Equal(t, 2, row.Laps)
+	assert.Equal(t, "09:10:00.001", row.FinishLine)
+	assert.Equal(t, []string(nil), row.Flags)
+}
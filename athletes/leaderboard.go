@@ -3,116 +3,580 @@ package athletes
 import (
 	"fmt"
 	"sort"
+	"sync"
 	"time"
+
+	"gitlab.com/mooncascade/event-timing-server/metrics"
 )
 
 // Leaderboard interface
 //
-// CurrentState returns sorted []LeaderboardRow.
+// CurrentState returns sorted []LeaderboardRow. Returned slice is a snapshot
+// which is not changed by further updates and must not be modified by caller.
+//
+// Find returns LeaderboardRow by chipID.
+//
+// FindAt returns LeaderboardRow of athlete chipID was assigned to at clockTime.
 //
 // FindAndUpdate finds LeaderboardRow by chipID and modifies it.
 // Returns modified LeaderboardRow
+//
+// FindAndUpdateCorrected is FindAndUpdate for clock time corrected by device clock offset,
+// rawClockTime reported by device is stored alongside. Read is credited to athlete chipID
+// was assigned to at clockTime
+//
+// AssignChip assigns chipID to athlete with startNumber at clockTime, athlete keeps previously
+// assigned chips. Returns modified LeaderboardRow
+//
+// UnassignChip removes chipID at clockTime from athlete it is assigned to.
+// Returns modified LeaderboardRow
+//
+// Snapshot returns CurrentState together with its version. Version changes
+// on every change of leaderboard
+//
+// Reload merges athletes and chips into leaderboard, timings of remaining athletes are kept.
+// Returns RosterChanges
+//
+// Status returns AthleteStatus of athlete with startNumber together with version of Snapshot it belongs to
 type Leaderboard interface {
 	CurrentState() []LeaderboardRow
+	Snapshot() ([]LeaderboardRow, uint64)
+	Find(chipID string) (LeaderboardRow, error)
+	FindAt(chipID, clockTime string) (LeaderboardRow, error)
 	FindAndUpdate(chipID, timingPointID, clockTime string) (LeaderboardRow, error)
+	FindAndUpdateCorrected(chipID, timingPointID, clockTime, rawClockTime string) (LeaderboardRow, error)
+	AssignChip(chipID string, startNumber int, clockTime string) (LeaderboardRow, error)
+	UnassignChip(chipID, clockTime string) (LeaderboardRow, error)
+	Reload(Athletes, Chips) RosterChanges
+	Status(startNumber int) (AthleteStatus, uint64, error)
+}
+
+// RosterChanges lists start numbers of athletes added, updated and removed by Leaderboard.Reload
+type RosterChanges struct {
+	Added   []int `json:"added"`
+	Updated []int `json:"updated"`
+	Removed []int `json:"removed"`
+}
+
+// empty reports whether there are no changes
+func (c RosterChanges) empty() bool {
+	return len(c.Added) == 0 && len(c.Updated) == 0 && len(c.Removed) == 0
 }
 
-// LeaderboardRow represents one row on Leaderboard
+// LeaderboardRow represents one row on Leaderboard. Elapsed is finish_line time since
+// gun time of athlete's wave, empty until athlete finished or if gun time is not known.
+// In LapRace Laps is the number of completed laps with their LapSplits, finish_line is
+// the last counted crossing. Flags lists broken consistency Rules, empty if timings are consistent
 type LeaderboardRow struct {
 	Athlete
-	Timings `json:"timings"`
+	Timings   `json:"timings"`
+	Elapsed   string     `json:"elapsed,omitempty"`
+	Laps      int        `json:"laps,omitempty"`
+	LapSplits []LapSplit `json:"lap_splits,omitempty"`
+	Flags     []string   `json:"flags,omitempty"`
 }
 
 // Timings struct contains athlete time for
-// finish_corridor and finish_line in 15:04:05.999 format
+// finish_corridor and finish_line in 15:04:05.999 format.
+// Raw times are set only when time was corrected by device clock offset
 type Timings struct {
-	FinishCorridor string `json:"finish_corridor"`
-	FinishLine     string `json:"finish_line"`
+	FinishCorridor    string `json:"finish_corridor"`
+	FinishLine        string `json:"finish_line"`
+	FinishCorridorRaw string `json:"finish_corridor_raw,omitempty"`
+	FinishLineRaw     string `json:"finish_line_raw,omitempty"`
+}
+
+// clockTimeFormat is the format of timing points clock time
+const clockTimeFormat = "15:04:05.999"
+
+// get returns clock time of given timingPointID
+func (t Timings) get(timingPointID string) string {
+	if timingPointID == "finish_line" {
+		return t.FinishLine
+	}
+	return t.FinishCorridor
 }
 
-// leaderboard implements Leaderboard
+// getRaw returns raw clock time of given timingPointID, empty if it was not corrected
+func (t Timings) getRaw(timingPointID string) string {
+	if timingPointID == "finish_line" {
+		return t.FinishLineRaw
+	}
+	return t.FinishCorridorRaw
+}
+
+// sameClockTime reports whether a and b are the same clock time, e.g. 00:01:10.1 and 00:01:10.100
+func sameClockTime(a, b string) bool {
+	aTime, aErr := time.Parse(clockTimeFormat, a)
+	bTime, bErr := time.Parse(clockTimeFormat, b)
+	if aErr != nil || bErr != nil {
+		return a == b
+	}
+	return aTime.Equal(bTime)
+}
+
+// elapsedTime formats time since start of finishLine clock time in 15:04:05.999 format,
+// empty if finishLine is before start
+func elapsedTime(finishLine string, start time.Duration) string {
+	elapsed := parseClockTime(finishLine) - start
+	if elapsed < 0 {
+		return ""
+	}
+	return time.Time{}.Add(elapsed).Format(clockTimeFormat)
+}
+
+// leaderboard implements Leaderboard. Safe for concurrent use.
+// Rows are kept in ranking ordered by pre-parsed timings, rows maps start number
+// to its ranking node and chips maps every currently assigned chipID to start number.
+// periods keeps assignment history of chips of the day, so late reads are credited to
+// athlete chip was assigned to when read.
+// starts maps wave to its gun time as duration since midnight.
+// lapRace enables counting finish_line crossings of rows as laps.
+// state caches CurrentState until the next change, version counts changes.
+// median caches medianCorridorTime of state for one version
 type leaderboard struct {
-	Rows []LeaderboardRow
+	mu      sync.Mutex
+	ranking *rankNode
+	rows    map[int]*rankNode
+	rules   Rules
+	chips   map[string]int
+	periods map[string][]chipPeriod
+	starts  map[string]time.Duration
+	lapRace LapRace
+	state   []LeaderboardRow
+	version uint64
+	median  corridorMedian
 }
 
 // CurrentState returns current sorted leaderboard
-func (l leaderboard) CurrentState() []LeaderboardRow {
-	return l.Rows
+func (l *leaderboard) CurrentState() []LeaderboardRow {
+	rows, _ := l.Snapshot()
+	return rows
+}
+
+// Snapshot implements Leaderboard.Snapshot
+func (l *leaderboard) Snapshot() ([]LeaderboardRow, uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.snapshot(), l.version
+}
+
+// snapshot returns cached state, building it if needed. Must be called with l.mu held
+func (l *leaderboard) snapshot() []LeaderboardRow {
+	if l.state == nil {
+		l.state = l.ranking.appendRows(make([]LeaderboardRow, 0, l.ranking.len()))
+	}
+	return l.state
+}
+
+// Status implements Leaderboard.Status. Rank is taken from ranking in O(log n) expected
+//
+// Will return an error if athlete with given startNumber was not found
+func (l *leaderboard) Status(startNumber int) (AthleteStatus, uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	node, ok := l.rows[startNumber]
+	if !ok {
+		return AthleteStatus{}, l.version, StartNumberNotFound{startNumber}
+	}
+	return toAthleteStatus(node.row, l.ranking.rank(node.key)+1, l.corridorTime), l.version, nil
+}
+
+// corridorTime returns medianCorridorTime of current state, calculated once per version.
+// Must be called with l.mu held
+func (l *leaderboard) corridorTime() (time.Duration, bool) {
+	if l.median.version != l.version {
+		gap, ok := medianCorridorTime(l.snapshot())
+		l.median = corridorMedian{l.version, gap, ok}
+	}
+	return l.median.gap, l.median.ok
+}
+
+// changed drops cached state and increments version, must be called with l.mu held
+func (l *leaderboard) changed() {
+	l.state = nil
+	l.version++
+}
+
+// start returns gun time of wave, gun time of "" if wave has no gun time.
+// Returns false if neither is set, must be called with l.mu held
+func (l *leaderboard) start(wave string) (time.Duration, bool) {
+	if start, ok := l.starts[wave]; ok {
+		return start, true
+	}
+	start, ok := l.starts[""]
+	return start, ok
+}
+
+// insert calculates Elapsed, lap splits and key of node from its row and inserts node into ranking.
+// Node must not be in ranking, must be called with l.mu held
+func (l *leaderboard) insert(node *rankNode) {
+	start, ok := l.start(node.row.Wave)
+	node.row.Elapsed = ""
+	if ok && node.row.FinishLine != "" {
+		node.row.Elapsed = elapsedTime(node.row.FinishLine, start)
+	}
+	node.row.Laps, node.row.LapSplits = len(node.laps), lapSplits(node.laps, start, ok)
+	node.key = toRowKey(node.row, start)
+	node.left, node.right, node.size = nil, nil, 1
+	l.ranking = l.ranking.insert(node)
+}
+
+// Find implements Leaderboard.Find
+//
+// Will return an error if athlete with given chipID was not found
+func (l *leaderboard) Find(chipID string) (LeaderboardRow, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	node := l.chipNode(chipID)
+	if node == nil {
+		return LeaderboardRow{}, AtheleteNotFound{chipID}
+	}
+	return node.row, nil
+}
+
+// FindAt implements Leaderboard.FindAt
+//
+// Will return an error if chipID was not assigned at clockTime and is not assigned now
+func (l *leaderboard) FindAt(chipID, clockTime string) (LeaderboardRow, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	node := l.chipNodeAt(chipID, clockTime)
+	if node == nil {
+		return LeaderboardRow{}, AtheleteNotFound{chipID}
+	}
+	return node.row, nil
+}
+
+// chipNode returns ranking node of the athlete chipID is assigned to, nil if chipID is not assigned
+func (l *leaderboard) chipNode(chipID string) *rankNode {
+	startNumber, ok := l.chips[chipID]
+	if !ok {
+		return nil
+	}
+	return l.rows[startNumber]
+}
+
+// chipNodeAt returns ranking node of the athlete chipID was assigned to at clockTime.
+// Reads outside of ended assignments go to the current owner, e.g. quarantined reads
+// of chip assigned after them
+func (l *leaderboard) chipNodeAt(chipID, clockTime string) *rankNode {
+	at := parseClockTime(clockTime)
+	for _, p := range l.periods[chipID] {
+		if !p.open && p.from <= at && at < p.to {
+			if node, ok := l.rows[p.startNumber]; ok {
+				return node
+			}
+		}
+	}
+	return l.chipNode(chipID)
 }
 
 // FindAndUpdate implements Leaderboard.FindAndUpdate
 //
 // Will return an error if athlete with given chipID was not found
 //
-// After successful update, l.sort() is called which sorts leaderboard rows by time
-// the earliest athlete being first
+// After successful update, row is checked against consistency rules and moved
+// to its position in leaderboard, the earliest athlete being first. In LapRace
+// athletes with more laps go first, finish_line crossings which are not counted
+// as lap and finish_corridor crossings older than the latest one are rejected with LapNotCounted
 func (l *leaderboard) FindAndUpdate(chipID, timingPointID, clockTime string) (LeaderboardRow, error) {
-	for i, r := range l.Rows {
-		if r.ChipID == chipID {
-			if timingPointID == "finish_line" {
-				l.Rows[i].FinishLine = clockTime
-			} else {
-				l.Rows[i].FinishCorridor = clockTime
-			}
-			updatedRow := l.Rows[i]
-			l.sort()
-			return updatedRow, nil
+	return l.FindAndUpdateCorrected(chipID, timingPointID, clockTime, clockTime)
+}
+
+// FindAndUpdateCorrected implements Leaderboard.FindAndUpdateCorrected
+func (l *leaderboard) FindAndUpdateCorrected(chipID, timingPointID, clockTime, rawClockTime string) (LeaderboardRow, error) {
+	if rawClockTime == clockTime {
+		rawClockTime = ""
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	node := l.chipNodeAt(chipID, clockTime)
+	if node == nil {
+		return LeaderboardRow{}, AtheleteNotFound{chipID}
+	}
+	if l.lapRace.Enabled && timingPointID == "finish_line" {
+		laps, err := l.countLap(node, chipID, clockTime, rawClockTime)
+		if err != nil {
+			return node.row, err
 		}
+		node.laps = laps
+		last := laps[len(laps)-1]
+		clockTime, rawClockTime = last.clockTime, last.rawClockTime
+	}
+	if l.lapRace.Enabled && timingPointID != "finish_line" && node.row.FinishCorridor != "" &&
+		parseClockTime(clockTime) < parseClockTime(node.row.FinishCorridor) {
+		return node.row, LapNotCounted{chipID, clockTime, corridorOlder}
 	}
+	l.ranking = l.ranking.remove(node.key)
+	if timingPointID == "finish_line" {
+		node.row.FinishLine = clockTime
+		node.row.FinishLineRaw = rawClockTime
+	} else {
+		node.row.FinishCorridor = clockTime
+		node.row.FinishCorridorRaw = rawClockTime
+	}
+	node.row.Flags = l.check(node.row.Timings)
+	l.insert(node)
+	l.changed()
+	return node.row, nil
+}
 
-	return LeaderboardRow{}, AtheleteNotFound{chipID}
-}
-
-// sort by LeaderboardRow.FinishLine, LeaderboardRow.FinishCorridor and LeaderboardRow.StartNumber
-func (l leaderboard) sort() {
-	rows := l.Rows
-	sort.Slice(rows, func(i, j int) bool {
-		iRow := rows[i]
-		jRow := rows[j]
-		// Sort by finish_line
-		if len(iRow.FinishLine) > 0 || len(jRow.FinishLine) > 0 {
-			if len(iRow.FinishLine) == 0 {
-				return false
-			} else if len(jRow.FinishLine) == 0 {
-				return true
-			} else {
-				iTime, _ := time.Parse("15:04:05.999", iRow.FinishLine)
-				jTime, _ := time.Parse("15:04:05.999", jRow.FinishLine)
-				if !iTime.Equal(jTime) {
-					return iTime.Before(jTime)
-				}
-			}
+// SetRules replaces consistency Rules and re-checks all rows
+func (l *leaderboard) SetRules(rules Rules) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rules = rules
+	l.recheck()
+}
+
+// check returns flags of broken Rules, finish_corridor is not required in LapRace.
+// Must be called with l.mu held
+func (l *leaderboard) check(t Timings) []string {
+	rules := l.rules
+	if l.lapRace.Enabled {
+		rules.RequireCorridor = false
+	}
+	return rules.Check(t)
+}
+
+// recheck checks all rows against Rules, must be called with l.mu held
+func (l *leaderboard) recheck() {
+	for _, node := range l.rows {
+		node.row.Flags = l.check(node.row.Timings)
+	}
+	l.changed()
+}
+
+// SetLapRace sets lap counting, see LapRace. Must be set before timing events are applied
+func (l *leaderboard) SetLapRace(race LapRace) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lapRace = race
+	l.recheck()
+}
+
+// LapRace returns current lap counting
+func (l *leaderboard) LapRace() LapRace {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lapRace
+}
+
+// AssignChip implements Leaderboard.AssignChip
+//
+// Will return an error if chipID is assigned to another athlete or
+// athlete with given startNumber was not found. Empty clockTime is the current time
+func (l *leaderboard) AssignChip(chipID string, startNumber int, clockTime string) (LeaderboardRow, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if owner, ok := l.chips[chipID]; ok && owner != startNumber {
+		return LeaderboardRow{}, ChipAlreadyAssigned{chipID, owner}
+	}
+	node, ok := l.rows[startNumber]
+	if !ok {
+		return LeaderboardRow{}, StartNumberNotFound{startNumber}
+	}
+	if _, ok := l.chips[chipID]; !ok {
+		l.periods[chipID] = append(l.periods[chipID], chipPeriod{startNumber: startNumber, from: changeTime(clockTime), open: true})
+	}
+	l.chips[chipID] = startNumber
+	if node.row.ChipID == "" {
+		node.row.ChipID = chipID
+		l.changed()
+	}
+	return node.row, nil
+}
+
+// UnassignChip implements Leaderboard.UnassignChip
+//
+// Will return an error if chipID is not assigned to any athlete. If chipID was the
+// first chip of athlete, Athlete.ChipID is replaced by one of the remaining chips.
+// Empty clockTime is the current time
+func (l *leaderboard) UnassignChip(chipID, clockTime string) (LeaderboardRow, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	node := l.chipNode(chipID)
+	if node == nil {
+		return LeaderboardRow{}, AtheleteNotFound{chipID}
+	}
+	delete(l.chips, chipID)
+	for i, p := range l.periods[chipID] {
+		if p.open {
+			l.periods[chipID][i].open = false
+			l.periods[chipID][i].to = changeTime(clockTime)
 		}
-		// Sort by finish_corridor
-		if len(iRow.FinishCorridor) > 0 || len(jRow.FinishCorridor) > 0 {
-			if len(iRow.FinishCorridor) == 0 {
-				return false
-			} else if len(jRow.FinishCorridor) == 0 {
-				return true
-			} else {
-				iTime, _ := time.Parse("15:04:05.999", iRow.FinishCorridor)
-				jTime, _ := time.Parse("15:04:05.999", jRow.FinishCorridor)
-				if !iTime.Equal(jTime) {
-					return iTime.Before(jTime)
-				}
+	}
+	if node.row.ChipID == chipID {
+		node.row.ChipID = ""
+		for c, startNumber := range l.chips {
+			if startNumber == node.row.StartNumber && (node.row.ChipID == "" || c < node.row.ChipID) {
+				node.row.ChipID = c
 			}
 		}
-		// Sort by start number
-		return rows[i].StartNumber < rows[j].StartNumber
-	})
+		l.changed()
+	}
+	return node.row, nil
+}
+
+// Reload implements Leaderboard.Reload
+//
+// New athletes are added without timings, name, wave and first chip of existing athletes
+// are replaced and athletes missing from athletes are removed. Chip assignments are
+// replaced by chips
+func (l *leaderboard) Reload(athletes Athletes, chips Chips) RosterChanges {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	changes := RosterChanges{Added: []int{}, Updated: []int{}, Removed: []int{}}
+	l.chips = toChipIndex(athletes, chips)
+	l.periods = toChipPeriods(athletes, chips, time.Now())
+	present := map[int]bool{}
+	for _, a := range athletes {
+		present[a.StartNumber] = true
+		node, ok := l.rows[a.StartNumber]
+		if !ok {
+			node = newRankNode(LeaderboardRow{Athlete: a})
+			l.rows[a.StartNumber] = node
+			l.insert(node)
+			changes.Added = append(changes.Added, a.StartNumber)
+			continue
+		}
+		if node.row.Athlete != a {
+			l.ranking = l.ranking.remove(node.key)
+			node.row.Athlete = a
+			l.insert(node)
+			changes.Updated = append(changes.Updated, a.StartNumber)
+		}
+	}
+	for startNumber, node := range l.rows {
+		if !present[startNumber] {
+			l.ranking = l.ranking.remove(node.key)
+			delete(l.rows, startNumber)
+			changes.Removed = append(changes.Removed, startNumber)
+		}
+	}
+	sort.Ints(changes.Removed)
+	if !changes.empty() {
+		l.changed()
+	}
+	metrics.LeaderboardSize.Set(float64(len(l.rows)))
+	return changes
+}
+
+// SetStarts sets gun times by wave, gun time of "" is used for athletes without wave
+// and athletes of waves without gun time. Elapsed times are recalculated and rows are
+// ranked by time since start. Returns whether rows changed, version is changed on every
+// call as it is called on every change of race and waves served along with leaderboard.
+//
+// Gun times must be in 15:04:05.999 format. Ranking is rebuilt as keys of all rows may change
+func (l *leaderboard) SetStarts(starts map[string]string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.starts = map[string]time.Duration{}
+	for wave, gunTime := range starts {
+		l.starts[wave] = parseClockTime(gunTime)
+	}
+	changed := false
+	l.ranking = nil
+	for _, node := range l.rows {
+		key, elapsed := node.key, node.row.Elapsed
+		l.insert(node)
+		changed = changed || key != node.key || elapsed != node.row.Elapsed
+	}
+	l.changed()
+	return changed
 }
 
 // toLeaderboardRows constructs LeaderboardRows from Athletes
 func toLeaderboardRows(s Athletes) []LeaderboardRow {
 	l := []LeaderboardRow{}
 	for _, a := range s {
-		l = append(l, LeaderboardRow{a, Timings{}})
+		l = append(l, LeaderboardRow{Athlete: a})
 	}
 	return l
 }
 
-// NewLeaderboard initializes Leaderboard object by reading athletes data from store
+// toChipIndex maps chips of athletes and currently assigned chips to start numbers
+func toChipIndex(s Athletes, c Chips) map[string]int {
+	chips := map[string]int{}
+	for _, a := range s {
+		if a.ChipID != "" {
+			chips[a.ChipID] = a.StartNumber
+		}
+	}
+	for _, chip := range c.current() {
+		chips[chip.ChipID] = chip.StartNumber
+	}
+	return chips
+}
+
+// chipPeriod is a time of the day chip was assigned to athlete with startNumber,
+// from and to are durations since midnight. to is not set while assignment is open
+type chipPeriod struct {
+	startNumber int
+	from, to    time.Duration
+	open        bool
+}
+
+// toChipPeriods returns assignment periods of chips by chipID for the day of now.
+// Assignments made before the day start at midnight, assignments ended before
+// it are left out. Chips of athletes without assignment are assigned all day
+func toChipPeriods(s Athletes, c Chips, now time.Time) map[string][]chipPeriod {
+	periods := map[string][]chipPeriod{}
+	for _, chip := range c {
+		p := chipPeriod{startNumber: chip.StartNumber, from: sinceMidnight(chip.ValidFrom, now), open: chip.ValidTo == nil}
+		if !p.open {
+			p.to = sinceMidnight(*chip.ValidTo, now)
+			if p.to == 0 {
+				continue
+			}
+		}
+		periods[chip.ChipID] = append(periods[chip.ChipID], p)
+	}
+	for _, a := range s {
+		if _, ok := periods[a.ChipID]; a.ChipID != "" && !ok {
+			periods[a.ChipID] = []chipPeriod{{startNumber: a.StartNumber, open: true}}
+		}
+	}
+	return periods
+}
+
+// sinceMidnight returns t as duration since midnight of the day of now,
+// limited to the day
+func sinceMidnight(t, now time.Time) time.Duration {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	d := t.Sub(midnight)
+	if d < 0 {
+		return 0
+	}
+	if d > 24*time.Hour {
+		return 24 * time.Hour
+	}
+	return d
+}
+
+// changeTime returns clock time of chip assignment change as duration since midnight,
+// the current time if clockTime is empty
+func changeTime(clockTime string) time.Duration {
+	if clockTime == "" {
+		now := time.Now()
+		return sinceMidnight(now, now)
+	}
+	return parseClockTime(clockTime)
+}
+
+// NewLeaderboard initializes Leaderboard object by reading athletes and chips data from store
 func NewLeaderboard(s Store) (Leaderboard, error) {
+	l, err := newLeaderboard(s)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// newLeaderboard is NewLeaderboard returning leaderboard, which is also configured
+// by Service with rules, gun times and lap counting
+func newLeaderboard(s Store) (*leaderboard, error) {
 	athletes, err := s.FindAll()
 	if err != nil {
 		return nil, err
@@ -120,5 +584,23 @@ func NewLeaderboard(s Store) (Leaderboard, error) {
 	if len(athletes) == 0 {
 		return nil, fmt.Errorf("athletes table is empty")
 	}
-	return &leaderboard{toLeaderboardRows(athletes)}, nil
+	chips, err := s.FindChips()
+	if err != nil {
+		return nil, err
+	}
+	metrics.LeaderboardSize.Set(float64(len(athletes)))
+	l := &leaderboard{
+		rows:    map[int]*rankNode{},
+		rules:   DefaultRules,
+		chips:   toChipIndex(athletes, chips),
+		periods: toChipPeriods(athletes, chips, time.Now()),
+		starts:  map[string]time.Duration{},
+		version: 1,
+	}
+	for _, row := range toLeaderboardRows(athletes) {
+		node := newRankNode(row)
+		l.rows[row.StartNumber] = node
+		l.insert(node)
+	}
+	return l, nil
 }
@@ -1,37 +1,57 @@
 package athletes
 
 import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
 type storeMock struct{}
 
-func (storeMock) Close()            {}
-func (storeMock) Add(Athlete) error { return nil }
+func (storeMock) Close()                                  {}
+func (storeMock) Add(Athlete) error                       { return nil }
+func (storeMock) FindChips() (Chips, error)               { return Chips{}, nil }
+func (storeMock) AssignChip(string, int, time.Time) error { return nil }
+func (storeMock) UnassignChip(string, time.Time) error    { return nil }
+func (storeMock) Ping() error                             { return nil }
+func (storeMock) SchemaVersion() (uint, bool, error) {
+	return version, false, nil
+}
 func (storeMock) FindAll() (Athletes, error) {
 	return Athletes{
-		Athlete{"John", "Doe", "d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", 1},
-		Athlete{"Jonah", "Hubbard", "e058c321-b904-46ac-a7fb-9bf0ffeb518e", 2},
-		Athlete{"Felicia", "Perez", "32f637d8-40f9-454e-b7b5-88734865cba2", 3},
-		Athlete{"Rae", "Burns", "15c95b2b-e63e-442c-98c4-1be4ac871367", 4},
+		Athlete{"John", "Doe", "d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", 1, ""},
+		Athlete{"Jonah", "Hubbard", "e058c321-b904-46ac-a7fb-9bf0ffeb518e", 2, ""},
+		Athlete{"Felicia", "Perez", "32f637d8-40f9-454e-b7b5-88734865cba2", 3, ""},
+		Athlete{"Rae", "Burns", "15c95b2b-e63e-442c-98c4-1be4ac871367", 4, ""},
 	}, nil
 }
 
 type emptyStoreMock struct{}
 
-func (emptyStoreMock) Close()            {}
-func (emptyStoreMock) Add(Athlete) error { return nil }
+func (emptyStoreMock) Close()                                  {}
+func (emptyStoreMock) Add(Athlete) error                       { return nil }
+func (emptyStoreMock) FindChips() (Chips, error)               { return Chips{}, nil }
+func (emptyStoreMock) AssignChip(string, int, time.Time) error { return nil }
+func (emptyStoreMock) UnassignChip(string, time.Time) error    { return nil }
+func (emptyStoreMock) Ping() error                             { return nil }
+func (emptyStoreMock) SchemaVersion() (uint, bool, error) {
+	return version, false, nil
+}
 func (emptyStoreMock) FindAll() (Athletes, error) {
 	return Athletes{}, nil
 }
 
 var initialLeaderboardRows = []LeaderboardRow{
-	{Athlete{"John", "Doe", "d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", 1}, Timings{}},
-	{Athlete{"Jonah", "Hubbard", "e058c321-b904-46ac-a7fb-9bf0ffeb518e", 2}, Timings{}},
-	{Athlete{"Felicia", "Perez", "32f637d8-40f9-454e-b7b5-88734865cba2", 3}, Timings{}},
-	{Athlete{"Rae", "Burns", "15c95b2b-e63e-442c-98c4-1be4ac871367", 4}, Timings{}},
+	{Athlete: Athlete{"John", "Doe", "d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", 1, ""}, Timings: Timings{}},
+	{Athlete: Athlete{"Jonah", "Hubbard", "e058c321-b904-46ac-a7fb-9bf0ffeb518e", 2, ""}, Timings: Timings{}},
+	{Athlete: Athlete{"Felicia", "Perez", "32f637d8-40f9-454e-b7b5-88734865cba2", 3, ""}, Timings: Timings{}},
+	{Athlete: Athlete{"Rae", "Burns", "15c95b2b-e63e-442c-98c4-1be4ac871367", 4, ""}, Timings: Timings{}},
 }
 
 func TestInitLeaderboard(t *testing.T) {
@@ -56,10 +76,10 @@ func TestCurrentState(t *testing.T) {
 }
 
 func TestUpdate(t *testing.T) {
-	var john = LeaderboardRow{Athlete{"John", "Doe", "d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", 1}, Timings{}}
-	var jonah = LeaderboardRow{Athlete{"Jonah", "Hubbard", "e058c321-b904-46ac-a7fb-9bf0ffeb518e", 2}, Timings{}}
-	var felicia = LeaderboardRow{Athlete{"Felicia", "Perez", "32f637d8-40f9-454e-b7b5-88734865cba2", 3}, Timings{}}
-	var rae = LeaderboardRow{Athlete{"Rae", "Burns", "15c95b2b-e63e-442c-98c4-1be4ac871367", 4}, Timings{}}
+	var john = LeaderboardRow{Athlete: Athlete{"John", "Doe", "d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", 1, ""}, Timings: Timings{}}
+	var jonah = LeaderboardRow{Athlete: Athlete{"Jonah", "Hubbard", "e058c321-b904-46ac-a7fb-9bf0ffeb518e", 2, ""}, Timings: Timings{}}
+	var felicia = LeaderboardRow{Athlete: Athlete{"Felicia", "Perez", "32f637d8-40f9-454e-b7b5-88734865cba2", 3, ""}, Timings: Timings{}}
+	var rae = LeaderboardRow{Athlete: Athlete{"Rae", "Burns", "15c95b2b-e63e-442c-98c4-1be4ac871367", 4, ""}, Timings: Timings{}}
 
 	john.FinishCorridor = "00:01:10.123"
 	var updatedLeaderboardRows = []LeaderboardRow{
@@ -87,10 +107,10 @@ func TestLeaderboardSort(t *testing.T) {
 	actualLeaderboardRows := leaderboard.CurrentState()
 	assert.Equal(t, initialLeaderboardRows, actualLeaderboardRows)
 
-	var john = LeaderboardRow{Athlete{"John", "Doe", "d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", 1}, Timings{}}
-	var jonah = LeaderboardRow{Athlete{"Jonah", "Hubbard", "e058c321-b904-46ac-a7fb-9bf0ffeb518e", 2}, Timings{}}
-	var felicia = LeaderboardRow{Athlete{"Felicia", "Perez", "32f637d8-40f9-454e-b7b5-88734865cba2", 3}, Timings{}}
-	var rae = LeaderboardRow{Athlete{"Rae", "Burns", "15c95b2b-e63e-442c-98c4-1be4ac871367", 4}, Timings{}}
+	var john = LeaderboardRow{Athlete: Athlete{"John", "Doe", "d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", 1, ""}, Timings: Timings{}}
+	var jonah = LeaderboardRow{Athlete: Athlete{"Jonah", "Hubbard", "e058c321-b904-46ac-a7fb-9bf0ffeb518e", 2, ""}, Timings: Timings{}}
+	var felicia = LeaderboardRow{Athlete: Athlete{"Felicia", "Perez", "32f637d8-40f9-454e-b7b5-88734865cba2", 3, ""}, Timings: Timings{}}
+	var rae = LeaderboardRow{Athlete: Athlete{"Rae", "Burns", "15c95b2b-e63e-442c-98c4-1be4ac871367", 4, ""}, Timings: Timings{}}
 
 	// Update 1
 	john.FinishCorridor = "00:01:10.342"
@@ -182,3 +202,142 @@ func TestLeaderboardSort(t *testing.T) {
 	actualLeaderboardRows = leaderboard.CurrentState()
 	assert.Equal(t, updatedLeaderboardRows, actualLeaderboardRows)
 }
+
+// marathonStoreMock has n athletes with chip ids chip-1, chip-2, ...
+type marathonStoreMock struct {
+	storeMock
+	n int
+}
+
+func (s marathonStoreMock) FindAll() (Athletes, error) {
+	athletes := make(Athletes, s.n)
+	for i := range athletes {
+		athletes[i] = Athlete{"First", "Last", fmt.Sprintf("chip-%d", i+1), i + 1, ""}
+	}
+	return athletes, nil
+}
+
+func randomClockTime(r *rand.Rand) string {
+	return fmt.Sprintf("02:%02d:%02d.%03d", r.Intn(60), r.Intn(60), r.Intn(1000))
+}
+
+func TestLeaderboardOrder(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	leaderboard, _ := NewLeaderboard(marathonStoreMock{n: 500})
+	for i := 0; i < 2000; i++ {
+		timingPointID := "finish_corridor"
+		if r.Intn(2) == 0 {
+			timingPointID = "finish_line"
+		}
+		_, err := leaderboard.FindAndUpdate(fmt.Sprintf("chip-%d", r.Intn(500)+1), timingPointID, randomClockTime(r))
+		assert.Equal(t, nil, err)
+	}
+
+	rows := leaderboard.CurrentState()
+	assert.Equal(t, 500, len(rows))
+	expected := make([]LeaderboardRow, len(rows))
+	copy(expected, rows)
+	sort.SliceStable(expected, func(i, j int) bool {
+		return toRowKey(expected[i], 0).less(toRowKey(expected[j], 0))
+	})
+	assert.Equal(t, expected, rows)
+	for i := 1; i < len(rows); i++ {
+		if rows[i].FinishLine != "" && rows[i-1].FinishLine != "" {
+			assert.True(t, rows[i-1].FinishLine <= rows[i].FinishLine)
+		}
+	}
+}
+
+func TestLeaderboardConcurrency(t *testing.T) {
+	leaderboard, _ := newLeaderboard(marathonStoreMock{n: 100})
+	snapshot := leaderboard.CurrentState()
+	expected := make([]LeaderboardRow, len(snapshot))
+	copy(expected, snapshot)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(w)))
+			for i := 0; i < 200; i++ {
+				chipID := fmt.Sprintf("chip-%d", r.Intn(100)+1)
+				switch i % 5 {
+				case 0:
+					leaderboard.FindAndUpdate(chipID, "finish_corridor", randomClockTime(r))
+				case 1:
+					leaderboard.FindAndUpdateCorrected(chipID, "finish_line", randomClockTime(r), randomClockTime(r))
+				case 2:
+					leaderboard.Find(chipID)
+				case 3:
+					rows := leaderboard.CurrentState()
+					assert.Equal(t, 100, len(rows))
+					_, err := json.Marshal(rows)
+					assert.Equal(t, nil, err)
+				case 4:
+					spareChip := fmt.Sprintf("spare-%d-%d", w, i)
+					leaderboard.AssignChip(spareChip, r.Intn(100)+1, "")
+					leaderboard.UnassignChip(spareChip, "")
+					leaderboard.SetRules(DefaultRules)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// Snapshot taken before updates is unchanged
+	assert.Equal(t, expected, snapshot)
+	assert.NotEqual(t, snapshot, leaderboard.CurrentState())
+}
+
+func TestConcurrentTimingEvents(t *testing.T) {
+	service := newTestService(t)
+	chips := []string{
+		"d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17",
+		"e058c321-b904-46ac-a7fb-9bf0ffeb518e",
+		"32f637d8-40f9-454e-b7b5-88734865cba2",
+		"aaaaaaaa-e63e-442c-98c4-1be4ac871367",
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				service.processTimingEvent(timingRequest{chips[(w+i)%len(chips)], "finish_line", fmt.Sprintf("00:01:%02d", i), fmt.Sprintf("mat-%d", w)})
+				service.leadeboard.CurrentState()
+			}
+		}(w)
+	}
+	wg.Wait()
+	assert.Equal(t, 4, len(service.devices.All()))
+	assert.Equal(t, 50, len(service.unmatched.all()))
+}
+
+func BenchmarkFindAndUpdate(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	leaderboard, _ := NewLeaderboard(marathonStoreMock{n: 20000})
+	chips := make([]string, b.N)
+	clockTimes := make([]string, b.N)
+	for i := range chips {
+		chips[i] = fmt.Sprintf("chip-%d", r.Intn(20000)+1)
+		clockTimes[i] = randomClockTime(r)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		leaderboard.FindAndUpdate(chips[i], "finish_line", clockTimes[i])
+	}
+}
+
+func BenchmarkCurrentState(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	leaderboard, _ := NewLeaderboard(marathonStoreMock{n: 20000})
+	for i := 0; i < 20000; i++ {
+		leaderboard.FindAndUpdate(fmt.Sprintf("chip-%d", i+1), "finish_line", randomClockTime(r))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		leaderboard.FindAndUpdate(fmt.Sprintf("chip-%d", r.Intn(20000)+1), "finish_line", randomClockTime(r))
+		leaderboard.CurrentState()
+	}
+}
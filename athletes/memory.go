@@ -0,0 +1,120 @@
+package athletes
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// demoAthletes are athletes of memory store opened with "memory://" connection string
+var demoAthletes = Athletes{
+	Athlete{"John", "Doe", "d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", 1, ""},
+	Athlete{"Jonah", "Hubbard", "e058c321-b904-46ac-a7fb-9bf0ffeb518e", 2, ""},
+	Athlete{"Felicia", "Perez", "32f637d8-40f9-454e-b7b5-88734865cba2", 3, ""},
+	Athlete{"Rae", "Burns", "15c95b2b-e63e-442c-98c4-1be4ac871367", 4, ""},
+}
+
+// memoryStore implements Store keeping athletes and chips in memory, data is lost
+// on Close. Chips are kept in order of assignment, same as rows of 'chips' table
+type memoryStore struct {
+	mu       sync.Mutex
+	athletes map[int]Athlete
+	chips    Chips
+}
+
+// NewMemoryStore returns Store which keeps athletes and chips in memory
+func NewMemoryStore(athletes Athletes) (Store, error) {
+	s := &memoryStore{athletes: map[int]Athlete{}, chips: Chips{}}
+	for _, a := range athletes {
+		if err := s.Add(a); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *memoryStore) Close() {}
+
+func (s *memoryStore) Ping() error {
+	return nil
+}
+
+func (s *memoryStore) SchemaVersion() (uint, bool, error) {
+	return version, false, nil
+}
+
+func (s *memoryStore) FindAll() (Athletes, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	aSlice := Athletes{}
+	for _, a := range s.athletes {
+		a.ChipID = ""
+		for _, c := range s.chips {
+			if c.StartNumber == a.StartNumber && c.ValidTo == nil {
+				a.ChipID = c.ChipID
+				break
+			}
+		}
+		aSlice = append(aSlice, a)
+	}
+	sort.Slice(aSlice, func(i, j int) bool { return aSlice[i].StartNumber < aSlice[j].StartNumber })
+	return aSlice, nil
+}
+
+func (s *memoryStore) Add(a Athlete) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.athletes[a.StartNumber]; ok {
+		return fmt.Errorf("athlete with start number %d already exists", a.StartNumber)
+	}
+	if a.ChipID != "" && s.activeChip(a.ChipID) != nil {
+		return fmt.Errorf("chip %s is already assigned", a.ChipID)
+	}
+	s.athletes[a.StartNumber] = Athlete{FirstName: a.FirstName, LastName: a.LastName, StartNumber: a.StartNumber, Wave: a.Wave}
+	if a.ChipID != "" {
+		s.chips = append(s.chips, Chip{ChipID: a.ChipID, StartNumber: a.StartNumber, ValidFrom: time.Now()})
+	}
+	return nil
+}
+
+func (s *memoryStore) FindChips() (Chips, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append(Chips{}, s.chips...), nil
+}
+
+func (s *memoryStore) AssignChip(chipID string, startNumber int, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.athletes[startNumber]; !ok {
+		return StartNumberNotFound{startNumber}
+	}
+	s.unassign(chipID, at)
+	s.chips = append(s.chips, Chip{ChipID: chipID, StartNumber: startNumber, ValidFrom: at})
+	return nil
+}
+
+func (s *memoryStore) UnassignChip(chipID string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unassign(chipID, at)
+	return nil
+}
+
+// activeChip returns current assignment of chipID or nil, must be called with s.mu held
+func (s *memoryStore) activeChip(chipID string) *Chip {
+	for i := range s.chips {
+		if s.chips[i].ChipID == chipID && s.chips[i].ValidTo == nil {
+			return &s.chips[i]
+		}
+	}
+	return nil
+}
+
+// unassign ends validity of current assignment of chipID at time at, must be called with s.mu held
+func (s *memoryStore) unassign(chipID string, at time.Time) {
+	if c := s.activeChip(chipID); c != nil {
+		c.ValidTo = &at
+	}
+}
@@ -0,0 +1,8 @@
+ALTER TABLE athletes ADD COLUMN chip_id uuid;
+UPDATE athletes a SET chip_id = COALESCE(
+    (SELECT c.chip_id FROM chips c WHERE c.start_number = a.start_number AND c.valid_to IS NULL ORDER BY c.valid_from, c.id LIMIT 1),
+    gen_random_uuid()
+);
+ALTER TABLE athletes DROP CONSTRAINT athletes_pkey;
+ALTER TABLE athletes ADD PRIMARY KEY (chip_id);
+DROP TABLE IF EXISTS chips;
\ No newline at end of file
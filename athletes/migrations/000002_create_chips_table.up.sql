@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS chips (
+    id serial PRIMARY KEY,
+    chip_id uuid NOT NULL,
+    start_number integer NOT NULL,
+    valid_from timestamptz NOT NULL DEFAULT now(),
+    valid_to timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS chips_active_chip_id_idx ON chips (chip_id) WHERE valid_to IS NULL;
+INSERT INTO chips (chip_id, start_number, valid_from) SELECT chip_id, start_number, '-infinity' FROM athletes;
+ALTER TABLE athletes DROP CONSTRAINT athletes_pkey;
+ALTER TABLE athletes DROP COLUMN chip_id;
+ALTER TABLE athletes ADD PRIMARY KEY (start_number);
+ALTER TABLE chips ADD FOREIGN KEY (start_number) REFERENCES athletes (start_number) ON DELETE CASCADE;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE athletes DROP COLUMN wave;
\ No newline at end of file
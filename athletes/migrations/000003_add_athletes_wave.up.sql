@@ -0,0 +1 @@
+ALTER TABLE athletes ADD COLUMN wave varchar(32) NOT NULL DEFAULT '';
\ No newline at end of file
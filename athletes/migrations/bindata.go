@@ -3,6 +3,10 @@
 // Package migrations generated by go-bindata.// sources:
 // athletes/migrations/000001_create_athletes_table.down.sql
 // athletes/migrations/000001_create_athletes_table.up.sql
+// athletes/migrations/000002_create_chips_table.down.sql
+// athletes/migrations/000002_create_chips_table.up.sql
+// athletes/migrations/000003_add_athletes_wave.down.sql
+// athletes/migrations/000003_add_athletes_wave.up.sql
 package migrations
 
 import (
@@ -119,6 +123,86 @@ func _000001_create_athletes_tableUpSql() (*asset, error) {
 	return a, nil
 }
 
+var __000002_create_chips_tableDownSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x74\x90\xcb\x6a\xf3\x30\x10\x85\xf7\x7e\x8a\xb3\xb4\x21\x18\xfe\xb5\xc9\x42\xb1\x26\xfc\xa2\xb2\x15\x24\x85\x36\x2b\xa1\xca\x6e\x23\x9a\x8b\xf1\xa5\xd0\xb7\x2f\x71\x5b\xd3\x42\xbb\x9d\xf3\xcd\x30\xdf\x61\xd2\x92\x86\x65\x1b\x49\xf0\xe3\xf1\xd4\x8e\xed\x00\xc6\x39\x4a\x25\xf7\x55\x8d\x70\x8c\x9d\x8b\x0d\xa6\x29\x36\x45\xb2\xdf\x71\x66\xbf\x81\x1e\x86\xec\xc2\xac\x51\x2a\x26\xc9\x94\x94\x26\x00\x90\x1a\x92\x54\x5a\x84\xfc\x8b\xd8\x6a\x55\xcd\xf8\x80\x80\xfb\xff\xa4\x09\x21\x1f\x46\xdf\x8f\xee\x32\x9d\x1f\xdb\x1e\x6b\xf8\x9f\x03\x56\x73\x84\xfc\xd5\x9f\x62\xe3\xc6\x2b\x84\x41\xbd\x97\x12\x4a\x73\xd2\xd8\x1c\x96\xec\xa9\xbf\x9e\x57\x08\x79\x6c\x20\x45\x25\x2c\xfe\x65\xab\xf9\x8b\xe7\xf6\xe2\x7a\x7f\x69\xae\x67\x77\x93\x48\xb3\x24\x2b\x92\x5f\xb5\xb9\x56\x3b\x94\xaa\x36\x56\x33\x51\xdb\x25\x70\xdd\x4b\xfb\xf6\xc7\xce\xad\xaa\x9d\x16\x15\xd3\x07\xdc\xd1\x01\xe9\xa7\x6a\x56\x24\xf3\xb9\x0f\x5c\x6c\x41\x0f\xc2\x58\x83\x70\x8c\xdd\x50\xbc\x0f\x00\x00\xee\xae\xbf\x76\x01\x00\x00")
+
+func _000002_create_chips_tableDownSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__000002_create_chips_tableDownSql,
+		"000002_create_chips_table.down.sql",
+	)
+}
+
+func _000002_create_chips_tableDownSql() (*asset, error) {
+	bytes, err := _000002_create_chips_tableDownSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "000002_create_chips_table.down.sql", size: 0, mode: os.FileMode(0), modTime: time.Unix(0, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var __000002_create_chips_tableUpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x7c\x91\xc1\x8e\xda\x30\x14\x45\xf7\xf9\x8a\xbb\x1b\x22\xd1\x2f\xc8\xca\x4d\x5e\x5a\xab\xc6\x9e\xda\x8e\x3a\xb3\x8a\x52\x62\x8a\x55\x12\x50\x62\x68\xe9\xd7\x57\x40\x80\x80\x60\xb6\x7e\xe7\xf8\xdd\xab\x97\x6a\x62\x96\x60\xd9\x67\x41\xe0\x39\xa4\xb2\xa0\x37\x6e\xac\xc1\x7c\xe9\x37\x3d\x26\x11\x00\xf8\x1a\xbd\xeb\x7c\xb5\xc2\xab\xe6\x33\xa6\xdf\xf1\x8d\xde\xa7\xc7\xd1\x01\x2b\x7d\x8d\xed\xd6\xd7\x47\x5d\x16\x42\x9c\x46\x7d\xa8\xba\x50\xb6\xdb\xe6\xa7\xeb\xe0\xdb\xe0\x7e\xb9\xee\x0e\xd9\x55\x2b\x5f\x97\x8b\x6e\xdd\x20\xf8\xc6\xf5\xa1\x6a\x36\xe1\xdf\x05\x42\x46\x39\x2b\x84\x45\xbb\xfe\x33\x89\xc7\x4a\x58\x8f\x85\x28\x4e\xa2\xa1\x4a\x21\xf9\xf7\x82\xc0\x65\x46\x6f\x8f\x1a\x95\xd5\x3c\xf8\x9d\x2b\x87\xdc\xa5\xaf\xff\x42\xc9\x73\xdb\xe1\x35\xc6\x8f\xaf\xa4\xe9\xba\x8b\x9b\x63\x9e\x24\xe2\xd2\x90\xb6\xe0\xd2\xaa\x3b\x67\x7a\xd3\x77\x3a\xb8\x87\x6a\x31\x0c\x09\x4a\x2d\x9e\x90\x2f\x9f\x7c\xbb\xf0\xad\x0f\xfb\x17\xe4\x5a\xcd\x50\x85\xe5\xca\x05\xd7\x27\x11\x13\x96\xf4\x70\x9e\xf3\x2b\x32\xad\x5e\x91\x2a\x69\xac\x66\x5c\xda\x0b\x5e\x6e\x7e\xbb\xfd\xc7\x8e\x28\x66\xf2\x1c\xe3\x09\xc9\xb2\x6c\x7c\x65\x4c\xc6\x61\xe3\x5b\xe9\xf0\xd3\xc9\xc8\x95\x26\xfe\x45\x3e\x30\xa0\x29\x27\x4d\x32\x25\x73\x5d\x72\x87\x28\x89\x8c\x04\x59\x42\xca\x4c\xca\x32\x4a\xfe\x0f\x00\x2f\xf1\x7d\xfb\x99\x02\x00\x00")
+
+func _000002_create_chips_tableUpSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__000002_create_chips_tableUpSql,
+		"000002_create_chips_table.up.sql",
+	)
+}
+
+func _000002_create_chips_tableUpSql() (*asset, error) {
+	bytes, err := _000002_create_chips_tableUpSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "000002_create_chips_table.up.sql", size: 0, mode: os.FileMode(0), modTime: time.Unix(0, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var __000003_add_athletes_waveDownSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x00\x26\x00\xd9\xff\x41\x4c\x54\x45\x52\x20\x54\x41\x42\x4c\x45\x20\x61\x74\x68\x6c\x65\x74\x65\x73\x20\x44\x52\x4f\x50\x20\x43\x4f\x4c\x55\x4d\x4e\x20\x77\x61\x76\x65\x3b\x03\x00\xf7\xdf\x65\x48\x26\x00\x00\x00")
+
+func _000003_add_athletes_waveDownSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__000003_add_athletes_waveDownSql,
+		"000003_add_athletes_wave.down.sql",
+	)
+}
+
+func _000003_add_athletes_waveDownSql() (*asset, error) {
+	bytes, err := _000003_add_athletes_waveDownSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "000003_add_athletes_wave.down.sql", size: 0, mode: os.FileMode(0), modTime: time.Unix(0, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var __000003_add_athletes_waveUpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x00\x45\x00\xba\xff\x41\x4c\x54\x45\x52\x20\x54\x41\x42\x4c\x45\x20\x61\x74\x68\x6c\x65\x74\x65\x73\x20\x41\x44\x44\x20\x43\x4f\x4c\x55\x4d\x4e\x20\x77\x61\x76\x65\x20\x76\x61\x72\x63\x68\x61\x72\x28\x33\x32\x29\x20\x4e\x4f\x54\x20\x4e\x55\x4c\x4c\x20\x44\x45\x46\x41\x55\x4c\x54\x20\x27\x27\x3b\x03\x00\xba\xf9\xc1\x6d\x45\x00\x00\x00")
+
+func _000003_add_athletes_waveUpSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__000003_add_athletes_waveUpSql,
+		"000003_add_athletes_wave.up.sql",
+	)
+}
+
+func _000003_add_athletes_waveUpSql() (*asset, error) {
+	bytes, err := _000003_add_athletes_waveUpSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "000003_add_athletes_wave.up.sql", size: 0, mode: os.FileMode(0), modTime: time.Unix(0, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
 // Asset loads and returns the asset for the given name.
 // It returns an error if the asset could not be found or
 // could not be loaded.
@@ -173,6 +257,10 @@ func AssetNames() []string {
 var _bindata = map[string]func() (*asset, error){
 	"000001_create_athletes_table.down.sql": _000001_create_athletes_tableDownSql,
 	"000001_create_athletes_table.up.sql":   _000001_create_athletes_tableUpSql,
+	"000002_create_chips_table.down.sql":    _000002_create_chips_tableDownSql,
+	"000002_create_chips_table.up.sql":      _000002_create_chips_tableUpSql,
+	"000003_add_athletes_wave.down.sql":     _000003_add_athletes_waveDownSql,
+	"000003_add_athletes_wave.up.sql":       _000003_add_athletes_waveUpSql,
 }
 
 // AssetDir returns the file names below a certain
@@ -218,6 +306,10 @@ type bintree struct {
 var _bintree = &bintree{nil, map[string]*bintree{
 	"000001_create_athletes_table.down.sql": &bintree{_000001_create_athletes_tableDownSql, map[string]*bintree{}},
 	"000001_create_athletes_table.up.sql":   &bintree{_000001_create_athletes_tableUpSql, map[string]*bintree{}},
+	"000002_create_chips_table.down.sql":    &bintree{_000002_create_chips_tableDownSql, map[string]*bintree{}},
+	"000002_create_chips_table.up.sql":      &bintree{_000002_create_chips_tableUpSql, map[string]*bintree{}},
+	"000003_add_athletes_wave.down.sql":     &bintree{_000003_add_athletes_waveDownSql, map[string]*bintree{}},
+	"000003_add_athletes_wave.up.sql":       &bintree{_000003_add_athletes_waveUpSql, map[string]*bintree{}},
 }}
 
 // RestoreAsset restores an asset under the given directory
@@ -0,0 +1,66 @@
+package athletes
+
+import (
+	"sync"
+	"time"
+)
+
+// UnmatchedRead is a timing read of a chip which is not assigned to any athlete.
+// ClockTime is already corrected by device clock offset
+type UnmatchedRead struct {
+	ChipID        string    `json:"chip_id"`
+	TimingPointID string    `json:"timing_point_id"`
+	ClockTime     string    `json:"clock_time"`
+	RawClockTime  string    `json:"raw_clock_time,omitempty"`
+	DeviceID      string    `json:"device_id,omitempty"`
+	ReceivedAt    time.Time `json:"received_at"`
+}
+
+// quarantine keeps unmatched reads in order they were received. Safe for concurrent use
+type quarantine struct {
+	mu    sync.Mutex
+	reads []UnmatchedRead
+}
+
+func newQuarantine() *quarantine {
+	return &quarantine{reads: []UnmatchedRead{}}
+}
+
+// add adds read unless read of the same chip at the same timing point and clock time
+// is already kept, e.g. received again from another instance during sync
+func (q *quarantine) add(read UnmatchedRead) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, kept := range q.reads {
+		if kept.ChipID == read.ChipID && kept.TimingPointID == read.TimingPointID && sameClockTime(kept.ClockTime, read.ClockTime) {
+			return
+		}
+	}
+	q.reads = append(q.reads, read)
+}
+
+// all returns copy of all unmatched reads
+func (q *quarantine) all() []UnmatchedRead {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	reads := make([]UnmatchedRead, len(q.reads))
+	copy(reads, q.reads)
+	return reads
+}
+
+// take removes and returns unmatched reads of chipID
+func (q *quarantine) take(chipID string) []UnmatchedRead {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	taken := []UnmatchedRead{}
+	kept := q.reads[:0]
+	for _, read := range q.reads {
+		if read.ChipID == chipID {
+			taken = append(taken, read)
+		} else {
+			kept = append(kept, read)
+		}
+	}
+	q.reads = kept
+	return taken
+}
@@ -0,0 +1,47 @@
+package athletes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuarantine(t *testing.T) {
+	service := newTestService(t)
+	unknownChip := "aaaaaaaa-e63e-442c-98c4-1be4ac871367"
+
+	_, err := service.processTimingEvent(timingRequest{unknownChip, "finish_corridor", "00:01:10", ""})
+	assert.Equal(t, ReadQuarantined{unknownChip}, err)
+	_, err = service.processTimingEvent(timingRequest{unknownChip, "finish_line", "00:01:15", ""})
+	assert.Equal(t, ReadQuarantined{unknownChip}, err)
+	_, err = service.processTimingEvent(timingRequest{"bbbbbbbb-e63e-442c-98c4-1be4ac871367", "finish_line", "00:01:16", ""})
+	assert.Equal(t, ReadQuarantined{"bbbbbbbb-e63e-442c-98c4-1be4ac871367"}, err)
+	assert.Equal(t, 3, len(service.unmatched.all()))
+
+	// Errors
+	_, _, err = service.AssignChip(unknownChip, 42, false)
+	assert.Equal(t, StartNumberNotFound{42}, err)
+	_, _, err = service.AssignChip("d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", 2, false)
+	assert.Equal(t, ChipAlreadyAssigned{"d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", 1}, err)
+	assert.Equal(t, 3, len(service.unmatched.all()))
+
+	// Additional chip
+	var jonah = LeaderboardRow{Athlete: Athlete{"Jonah", "Hubbard", "e058c321-b904-46ac-a7fb-9bf0ffeb518e", 2, ""}, Timings: Timings{}}
+	jonah.FinishCorridor = "00:01:10"
+	jonah.FinishLine = "00:01:15"
+	row, reads, err := service.AssignChip(unknownChip, 2, false)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, jonah, row)
+	assert.Equal(t, 2, len(reads))
+	assert.Equal(t, "finish_corridor", reads[0].TimingPointID)
+	assert.Equal(t, "finish_line", reads[1].TimingPointID)
+
+	unmatched := service.unmatched.all()
+	assert.Equal(t, 1, len(unmatched))
+	assert.Equal(t, "bbbbbbbb-e63e-442c-98c4-1be4ac871367", unmatched[0].ChipID)
+
+	assert.Equal(t, jonah, service.leadeboard.CurrentState()[0])
+	row, err = service.leadeboard.Find("e058c321-b904-46ac-a7fb-9bf0ffeb518e")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, jonah, row)
+}
@@ -0,0 +1,137 @@
+package athletes
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// defaultAroundLimit is the number of rows returned for around query without limit
+const defaultAroundLimit = 5
+
+// leaderboardQuery filters and paginates leaderboard
+//
+// Status keeps only athletes with the status, empty keeps all.
+//
+// Wave keeps only athletes of the wave, empty keeps all.
+//
+// Search keeps athletes whose name contains it, case insensitive, or whose start number equals it.
+//
+// Around returns athlete with given start number with Limit/2 neighbours on each side
+// instead of Offset. Zero Limit returns all rows
+type leaderboardQuery struct {
+	Offset int
+	Limit  int
+	Search string
+	Status string
+	Wave   string
+	Around int
+}
+
+// parseLeaderboardQuery reads offset, limit, q, status, wave and around parameters
+func parseLeaderboardQuery(values url.Values) (leaderboardQuery, error) {
+	q := leaderboardQuery{Search: strings.TrimSpace(values.Get("q")), Status: values.Get("status"), Wave: values.Get("wave")}
+	var err error
+	if q.Offset, err = parseNonNegative(values, "offset"); err != nil {
+		return q, err
+	}
+	if q.Limit, err = parseNonNegative(values, "limit"); err != nil {
+		return q, err
+	}
+	if q.Around, err = parseNonNegative(values, "around"); err != nil {
+		return q, err
+	}
+	if q.Status != "" && q.Status != StatusNotStarted && q.Status != StatusInCorridor && q.Status != StatusFinished {
+		return q, fmt.Errorf("status: unknown status %q", q.Status)
+	}
+	if values.Get("around") != "" {
+		if q.Around == 0 {
+			return q, fmt.Errorf("around: expected start number, got %q", values.Get("around"))
+		}
+		if values.Get("offset") != "" {
+			return q, fmt.Errorf("around: can not be used with offset")
+		}
+		if q.Limit == 0 {
+			q.Limit = defaultAroundLimit
+		}
+	}
+	return q, nil
+}
+
+// parseNonNegative parses integer parameter key, 0 if it is missing
+func parseNonNegative(values url.Values, key string) (int, error) {
+	value := values.Get(key)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s: expected non-negative integer, got %q", key, value)
+	}
+	return n, nil
+}
+
+// matches reports whether row passes Status, Wave and Search filters
+func (q leaderboardQuery) matches(row LeaderboardRow) bool {
+	if q.Status != "" && rowStatus(row) != q.Status {
+		return false
+	}
+	if q.Wave != "" && row.Wave != q.Wave {
+		return false
+	}
+	if q.Search == "" {
+		return true
+	}
+	if strconv.Itoa(row.StartNumber) == q.Search {
+		return true
+	}
+	name := strings.ToLower(row.FirstName + " " + row.LastName)
+	return strings.Contains(name, strings.ToLower(q.Search))
+}
+
+// apply filters rows and returns requested page, number of filtered rows and
+// offset of the page in filtered rows. rows are not modified.
+//
+// Will return an error if Around athlete is not among filtered rows
+func (q leaderboardQuery) apply(rows []LeaderboardRow) ([]LeaderboardRow, int, int, error) {
+	filtered := rows
+	if q.Status != "" || q.Wave != "" || q.Search != "" {
+		filtered = []LeaderboardRow{}
+		for _, row := range rows {
+			if q.matches(row) {
+				filtered = append(filtered, row)
+			}
+		}
+	}
+
+	offset := q.Offset
+	if q.Around > 0 {
+		index := -1
+		for i, row := range filtered {
+			if row.StartNumber == q.Around {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return nil, len(filtered), 0, StartNumberNotFound{q.Around}
+		}
+		offset = index - q.Limit/2
+		if q.Limit > len(filtered)-offset {
+			offset = len(filtered) - q.Limit
+		}
+		if offset < 0 {
+			offset = 0
+		}
+	}
+
+	if offset > len(filtered) {
+		offset = len(filtered)
+	}
+	end := len(filtered)
+	if q.Limit > 0 && q.Limit < end-offset {
+		end = offset + q.Limit
+	}
+	return filtered[offset:end], len(filtered), offset, nil
+}
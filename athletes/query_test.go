@@ -0,0 +1,125 @@
+package athletes
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLeaderboardQuery(t *testing.T) {
+	q, err := parseLeaderboardQuery(url.Values{"offset": {"10"}, "limit": {"20"}, "q": {" doe "}, "status": {"finished"}, "wave": {"B"}})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, leaderboardQuery{Offset: 10, Limit: 20, Search: "doe", Status: StatusFinished, Wave: "B"}, q)
+
+	q, err = parseLeaderboardQuery(url.Values{"around": {"3"}})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, leaderboardQuery{Around: 3, Limit: defaultAroundLimit}, q)
+
+	var invalidQueries = []url.Values{
+		{"offset": {"-1"}},
+		{"limit": {"ten"}},
+		{"status": {"running"}},
+		{"around": {"0"}},
+		{"around": {"3"}, "offset": {"1"}},
+	}
+	for _, values := range invalidQueries {
+		_, err = parseLeaderboardQuery(values)
+		assert.NotEqual(t, nil, err, values.Encode())
+	}
+}
+
+func TestLeaderboardQuery(t *testing.T) {
+	leaderboard, _ := NewLeaderboard(marathonStoreMock{n: 20})
+	leaderboard.FindAndUpdate("chip-7", "finish_line", "00:01:10")
+	leaderboard.FindAndUpdate("chip-3", "finish_line", "00:01:11")
+	leaderboard.FindAndUpdate("chip-12", "finish_corridor", "00:01:05")
+	rows := leaderboard.CurrentState()
+
+	startNumbers := func(rows []LeaderboardRow) []int {
+		numbers := []int{}
+		for _, row := range rows {
+			numbers = append(numbers, row.StartNumber)
+		}
+		return numbers
+	}
+
+	page, total, offset, err := leaderboardQuery{}.apply(rows)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 20, len(page))
+	assert.Equal(t, 20, total)
+	assert.Equal(t, 0, offset)
+
+	page, total, offset, err = leaderboardQuery{Offset: 2, Limit: 3}.apply(rows)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []int{12, 1, 2}, startNumbers(page))
+	assert.Equal(t, 20, total)
+	assert.Equal(t, 2, offset)
+
+	page, _, _, _ = leaderboardQuery{Offset: 30, Limit: 3}.apply(rows)
+	assert.Equal(t, []int{}, startNumbers(page))
+
+	// Huge limit does not overflow
+	page, _, offset, err = leaderboardQuery{Offset: 1, Limit: math.MaxInt64}.apply(rows)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 19, len(page))
+	assert.Equal(t, 1, offset)
+	page, _, offset, err = leaderboardQuery{Around: 19, Limit: math.MaxInt64}.apply(rows)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 20, len(page))
+	assert.Equal(t, 0, offset)
+
+	page, total, _, _ = leaderboardQuery{Status: StatusFinished}.apply(rows)
+	assert.Equal(t, []int{7, 3}, startNumbers(page))
+	assert.Equal(t, 2, total)
+
+	page, _, _, _ = leaderboardQuery{Search: "12"}.apply(rows)
+	assert.Equal(t, []int{12}, startNumbers(page))
+	page, total, _, _ = leaderboardQuery{Search: "FIRST la", Limit: 4}.apply(rows)
+	assert.Equal(t, 4, len(page))
+	assert.Equal(t, 20, total)
+
+	// Around
+	page, _, offset, err = leaderboardQuery{Around: 1, Limit: 5}.apply(rows)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []int{3, 12, 1, 2, 4}, startNumbers(page))
+	assert.Equal(t, 1, offset)
+	page, _, offset, _ = leaderboardQuery{Around: 7, Limit: 5}.apply(rows)
+	assert.Equal(t, []int{7, 3, 12, 1, 2}, startNumbers(page))
+	assert.Equal(t, 0, offset)
+	page, _, offset, _ = leaderboardQuery{Around: 19, Limit: 4}.apply(rows)
+	assert.Equal(t, []int{17, 18, 19, 20}, startNumbers(page))
+	assert.Equal(t, 16, offset)
+	_, _, _, err = leaderboardQuery{Around: 1, Limit: 5, Status: StatusFinished}.apply(rows)
+	assert.Equal(t, StartNumberNotFound{1}, err)
+
+	// Snapshot is not modified
+	assert.Equal(t, rows, leaderboard.CurrentState())
+}
+
+func TestLeaderboardHandlerQuery(t *testing.T) {
+	service := newTestService(t)
+	handler := service.LeaderboardHandler()
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/leaderboard?around=2&limit=3", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "4", w.Header().Get("X-Total-Count"))
+	assert.Equal(t, "0", w.Header().Get("X-Offset"))
+	var rows []LeaderboardRow
+	assert.Equal(t, nil, json.Unmarshal(w.Body.Bytes(), &rows))
+	assert.Equal(t, 3, len(rows))
+	assert.Equal(t, "Jonah", rows[1].FirstName)
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/leaderboard?around=42", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/leaderboard?limit=-1", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
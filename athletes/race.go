@@ -0,0 +1,213 @@
+package athletes
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// States of Race
+const (
+	RaceScheduled   = "scheduled"
+	RaceStarted     = "started"
+	RaceFinished    = "finished"
+	RaceProvisional = "provisional"
+	RaceOfficial    = "official"
+)
+
+// raceOrder is the position of known states of Race in lifecycle, state never moves back
+var raceOrder = map[string]int{RaceScheduled: 0, RaceStarted: 1, RaceFinished: 2, RaceProvisional: 3, RaceOfficial: 4}
+
+// raceTransition is a state change allowed by an action of race lifecycle
+type raceTransition struct {
+	from, to string
+}
+
+// raceTransitions by action: start with gun time, close finish,
+// publish provisional results and make results official. Start of started
+// race corrects its gun time, e.g. of race started by the first timing event
+var raceTransitions = map[string]raceTransition{
+	"start":       {RaceScheduled, RaceStarted},
+	"finish":      {RaceStarted, RaceFinished},
+	"provisional": {RaceFinished, RaceProvisional},
+	"official":    {RaceProvisional, RaceOfficial},
+}
+
+// Race is the lifecycle state of the event. GunTime is clock time of the start signal,
+// empty if race was started by the first timing event. ChangedAt is time of the last transition
+type Race struct {
+	State     string    `json:"state"`
+	GunTime   string    `json:"gun_time,omitempty"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// RaceStatus is sent to all connected ws clients when Race changes
+type RaceStatus struct {
+	Type string `json:"type"`
+	Race Race   `json:"race"`
+}
+
+// race guards Race of the Service. Timing events are accepted only in started state.
+// Scheduled race is started by the first timing event only if autoStart is set
+type race struct {
+	mu        sync.RWMutex
+	current   Race
+	autoStart bool
+}
+
+func newRace() *race {
+	return &race{current: Race{State: RaceScheduled, ChangedAt: time.Now()}}
+}
+
+func (r *race) get() Race {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current
+}
+
+// advance replaces Race with state of a later stage of lifecycle, used for races replicated
+// from other instances and journal. States may be skipped as events published while instance
+// was disconnected are lost. Returns false and current Race if state is unknown or not later
+// than current state, e.g. reordered or repeated events. Gun time of started race is
+// replaced by another one, see raceTransitions
+func (r *race) advance(state, gunTime string) (Race, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	order, ok := raceOrder[state]
+	corrected := state == RaceStarted && r.current.State == RaceStarted && gunTime != "" && gunTime != r.current.GunTime
+	if !ok || (order <= raceOrder[r.current.State] && !corrected) {
+		return r.current, false
+	}
+	r.current = Race{State: state, GunTime: gunTime, ChangedAt: time.Now()}
+	return r.current, true
+}
+
+// transition applies action and returns changed Race. Returns InvalidRaceTransition
+// if action is unknown or not allowed in current state
+func (r *race) transition(action, gunTime string) (Race, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := raceTransitions[action]
+	if !ok || (t.from != r.current.State && !(t.to == RaceStarted && r.current.State == RaceStarted)) {
+		return r.current, InvalidRaceTransition{action, r.current.State}
+	}
+	if t.to != RaceStarted {
+		gunTime = r.current.GunTime
+	}
+	r.current = Race{State: t.to, GunTime: gunTime, ChangedAt: time.Now()}
+	return r.current, nil
+}
+
+// open returns RaceNotOpen error if timing events are not accepted. With late set, timing
+// events of finished race are accepted, e.g. reads missing from live data found by Replay.
+// Scheduled race is started if autoStart is set, started reports whether it happened
+func (r *race) open(late bool) (current Race, started bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case r.current.State == RaceStarted, late && r.current.State == RaceFinished:
+		return r.current, false, nil
+	case r.current.State == RaceScheduled && r.autoStart:
+		r.current = Race{State: RaceStarted, ChangedAt: time.Now()}
+		return r.current, true, nil
+	}
+	return r.current, false, RaceNotOpen{r.current.State}
+}
+
+// SetAutoStart sets whether scheduled race is started by the first timing event,
+// otherwise timing events are rejected until race is started by TransitionRace.
+// Gun time of auto started race is set by start action later
+func (s Service) SetAutoStart(auto bool) {
+	s.race.mu.Lock()
+	s.race.autoStart = auto
+	s.race.mu.Unlock()
+}
+
+// TransitionRace applies action of race lifecycle, see raceTransitions.
+// Start requires gunTime, which is ignored by other actions
+func (s Service) TransitionRace(action, gunTime string) (Race, error) {
+	race, err := s.race.transition(action, gunTime)
+	if err != nil {
+		return race, err
+	}
+	s.raceChanged(race)
+	return race, nil
+}
+
+// raceChanged publishes race to other instances and notifies all connected ws clients.
+// Gun time of race is the start of athletes without wave, see updateStarts
+func (s Service) raceChanged(race Race) {
+	s.logger.Infof("Race: %s", race.State)
+	s.publish(replicatedEvent{Kind: replicatedRace, RaceState: race.State, GunTime: race.GunTime})
+	s.broadcastRace(race)
+	s.updateStarts()
+}
+
+func (s Service) broadcastRace(race Race) {
+	jsonData, err := json.Marshal(RaceStatus{"race_state", race})
+	if err != nil {
+		s.logger.Errorln(err.Error())
+		return
+	}
+	s.wsManager.SendMessageToAll(jsonData)
+}
+
+// raceTransitionRequest is body of RaceTransitionHandler, GunTime is required by start action
+type raceTransitionRequest struct {
+	GunTime string `json:"gun_time" validate:"omitempty,datetime=15:04:05.999"`
+}
+
+// RaceHandler responds with current Race
+func (s Service) RaceHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.writeRace(w, r, s.race.get())
+	}
+}
+
+// RaceTransitionHandler passes action URL parameter and gun time of request body
+// to TransitionRace and responds with changed Race. Transitions which are not
+// allowed in current state are responded with 409 status
+func (s Service) RaceTransitionHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		action := chi.URLParam(r, "action")
+		if _, ok := raceTransitions[action]; !ok {
+			writeError(w, "unknown action "+action, http.StatusNotFound)
+			return
+		}
+		request := raceTransitionRequest{}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				writeError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if err := s.Validate(request); err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if action == "start" && request.GunTime == "" {
+			writeError(w, "gun_time is required to start race", http.StatusBadRequest)
+			return
+		}
+
+		race, err := s.TransitionRace(action, request.GunTime)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusConflict)
+			return
+		}
+		s.writeRace(w, r, race)
+	}
+}
+
+func (s Service) writeRace(w http.ResponseWriter, r *http.Request, race Race) {
+	jsonData, err := json.Marshal(race)
+	if err != nil {
+		s.requestLogger(r).Errorln(err.Error())
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, jsonData, http.StatusOK)
+}
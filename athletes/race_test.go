@@ -0,0 +1,129 @@
+package athletes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/mooncascade/event-timing-server/lineprotocol"
+	"gitlab.com/mooncascade/event-timing-server/metrics"
+)
+
+func TestRaceLifecycle(t *testing.T) {
+	johnChip := "d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17"
+	jonahChip := "e058c321-b904-46ac-a7fb-9bf0ffeb518e"
+
+	// Race with auto start is started by the first timing event, gun time is set later
+	service := newTestService(t)
+	assert.Equal(t, RaceScheduled, service.race.get().State)
+	_, err := service.processTimingEvent(timingRequest{johnChip, "finish_line", "00:01:10", ""})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, Race{State: RaceStarted, ChangedAt: service.race.get().ChangedAt}, service.race.get())
+	race, err := service.TransitionRace("start", "00:00:10")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, Race{RaceStarted, "00:00:10", race.ChangedAt}, race)
+	row, _ := service.leadeboard.Find(johnChip)
+	assert.Equal(t, "00:01:00", row.Elapsed)
+
+	// Timing events are rejected until race is started
+	service = newTestService(t)
+	service.SetAutoStart(false)
+	rejected := metrics.TimingEvents.WithLabelValues(metrics.ResultRejected, "race_not_open", "finish_line")
+	before := testutil.ToFloat64(rejected)
+	_, err = service.processTimingEvent(timingRequest{johnChip, "finish_line", "00:01:10", ""})
+	assert.Equal(t, RaceNotOpen{RaceScheduled}, err)
+	assert.Equal(t, before+1, testutil.ToFloat64(rejected))
+
+	_, err = service.TransitionRace("finish", "")
+	assert.Equal(t, InvalidRaceTransition{"finish", RaceScheduled}, err)
+	race, err = service.TransitionRace("start", "00:00:00.000")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, RaceStarted, race.State)
+	assert.Equal(t, "00:00:00.000", race.GunTime)
+	_, err = service.processTimingEvent(timingRequest{johnChip, "finish_line", "00:01:10", ""})
+	assert.Equal(t, nil, err)
+
+	// Closed finish accepts only reads of Replay
+	race, err = service.TransitionRace("finish", "")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, Race{RaceFinished, "00:00:00.000", race.ChangedAt}, race)
+	_, err = service.processTimingEvent(timingRequest{jonahChip, "finish_line", "00:01:11", ""})
+	assert.Equal(t, RaceNotOpen{RaceFinished}, err)
+	report, err := service.Replay(strings.NewReader(jonahChip+",finish_line,00:01:11\n"), lineprotocol.DefaultFormat)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(report.Missing))
+
+	_, err = service.TransitionRace("provisional", "")
+	assert.Equal(t, nil, err)
+	_, err = service.Replay(strings.NewReader(johnChip+",finish_corridor,00:01:05\n"), lineprotocol.DefaultFormat)
+	assert.Equal(t, RaceNotOpen{RaceProvisional}, err)
+	race, err = service.TransitionRace("official", "")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, RaceOfficial, race.State)
+	_, err = service.TransitionRace("start", "00:00:00.000")
+	assert.Equal(t, InvalidRaceTransition{"start", RaceOfficial}, err)
+}
+
+func TestReplicatedRace(t *testing.T) {
+	service := newTestService(t)
+	apply := func(state string) error {
+		return service.applyReplicatedEvent(replicatedEvent{Kind: replicatedRace, RaceState: state, GunTime: "09:00:00"})
+	}
+	assert.Equal(t, nil, apply(RaceStarted))
+	// Gun time of started race is corrected, but not cleared
+	assert.Equal(t, nil, service.applyReplicatedEvent(replicatedEvent{Kind: replicatedRace, RaceState: RaceStarted, GunTime: "09:00:05"}))
+	assert.Equal(t, "09:00:05", service.race.get().GunTime)
+	assert.NotEqual(t, nil, service.applyReplicatedEvent(replicatedEvent{Kind: replicatedRace, RaceState: RaceStarted}))
+	// Events lost while disconnected may be skipped
+	assert.Equal(t, nil, apply(RaceProvisional))
+	assert.Equal(t, RaceProvisional, service.race.get().State)
+
+	// Reordered, repeated and unknown states do not move race back
+	assert.NotEqual(t, nil, apply(RaceFinished))
+	assert.NotEqual(t, nil, apply(RaceProvisional))
+	assert.NotEqual(t, nil, apply("paused"))
+	assert.Equal(t, Race{RaceProvisional, "09:00:00", service.race.get().ChangedAt}, service.race.get())
+}
+
+func TestRaceHandlers(t *testing.T) {
+	service := newTestService(t)
+	r := chi.NewRouter()
+	r.Get("/race", service.RaceHandler())
+	r.Post("/admin/race/{action}", service.RaceTransitionHandler())
+	r.Post("/update", service.ReceiveTimingEventHandler())
+	service.SetAutoStart(false)
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", path, strings.NewReader(body)))
+		return w
+	}
+
+	w := post("/update", `{"chip_id":"d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17","timing_point_id":"finish_line","clock_time":"00:01:10"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, http.StatusBadRequest, post("/admin/race/start", "").Code)
+	assert.Equal(t, http.StatusBadRequest, post("/admin/race/start", `{"gun_time":"9am"}`).Code)
+	assert.Equal(t, http.StatusNotFound, post("/admin/race/restart", "").Code)
+	assert.Equal(t, http.StatusConflict, post("/admin/race/official", "").Code)
+
+	w = post("/admin/race/start", `{"gun_time":"09:00:00"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var race Race
+	assert.Equal(t, nil, json.Unmarshal(w.Body.Bytes(), &race))
+	assert.Equal(t, RaceStarted, race.State)
+	assert.Equal(t, "09:00:00", race.GunTime)
+
+	w = post("/update", `{"chip_id":"d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17","timing_point_id":"finish_line","clock_time":"09:31:10"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/race", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, nil, json.Unmarshal(w.Body.Bytes(), &race))
+	assert.Equal(t, RaceStarted, race.State)
+}
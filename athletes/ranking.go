@@ -0,0 +1,181 @@
+package athletes
+
+import (
+	"math/rand"
+	"time"
+)
+
+// rowKey is the sort key of LeaderboardRow with pre-parsed timings relative to
+// gun time of athlete's wave. Rows are ordered by laps, more laps first, then by finish_line,
+// then by finish_corridor, rows without time go after rows with time, then by start number
+type rowKey struct {
+	laps           int
+	finishLine     time.Duration
+	finishCorridor time.Duration
+	hasLine        bool
+	hasCorridor    bool
+	startNumber    int
+}
+
+// toRowKey parses timings of row and subtracts start, time which can not be parsed is treated as midnight
+func toRowKey(row LeaderboardRow, start time.Duration) rowKey {
+	k := rowKey{laps: row.Laps, startNumber: row.StartNumber}
+	if row.FinishLine != "" {
+		k.hasLine = true
+		k.finishLine = parseClockTime(row.FinishLine) - start
+	}
+	if row.FinishCorridor != "" {
+		k.hasCorridor = true
+		k.finishCorridor = parseClockTime(row.FinishCorridor) - start
+	}
+	return k
+}
+
+// parseClockTime returns clock time as duration since midnight
+func parseClockTime(clockTime string) time.Duration {
+	t, _ := time.Parse(clockTimeFormat, clockTime)
+	return t.Sub(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()))
+}
+
+// less reports whether row with key k goes before row with key o
+func (k rowKey) less(o rowKey) bool {
+	if k.laps != o.laps {
+		return k.laps > o.laps
+	}
+	if k.hasLine != o.hasLine {
+		return k.hasLine
+	}
+	if k.hasLine && k.finishLine != o.finishLine {
+		return k.finishLine < o.finishLine
+	}
+	if k.hasCorridor != o.hasCorridor {
+		return k.hasCorridor
+	}
+	if k.hasCorridor && k.finishCorridor != o.finishCorridor {
+		return k.finishCorridor < o.finishCorridor
+	}
+	return k.startNumber < o.startNumber
+}
+
+// rankNode is a node of ranking, a treap ordered by rowKey.
+// size is the number of nodes in subtree, laps are counted crossings of LapRace
+type rankNode struct {
+	key         rowKey
+	row         LeaderboardRow
+	laps        []crossing
+	priority    uint32
+	size        int
+	left, right *rankNode
+}
+
+// newRankNode returns node of row, its key is set when node is inserted by leaderboard
+func newRankNode(row LeaderboardRow) *rankNode {
+	return &rankNode{row: row, priority: rand.Uint32(), size: 1}
+}
+
+func (n *rankNode) update() {
+	n.size = 1 + n.left.len() + n.right.len()
+}
+
+// len returns number of nodes in subtree, 0 for nil
+func (n *rankNode) len() int {
+	if n == nil {
+		return 0
+	}
+	return n.size
+}
+
+// insert adds node to subtree n and returns new root. O(log n) expected
+func (n *rankNode) insert(node *rankNode) *rankNode {
+	if n == nil {
+		return node
+	}
+	if node.priority > n.priority {
+		node.left, node.right = n.split(node.key)
+		node.update()
+		return node
+	}
+	if node.key.less(n.key) {
+		n.left = n.left.insert(node)
+	} else {
+		n.right = n.right.insert(node)
+	}
+	n.update()
+	return n
+}
+
+// remove removes node with key from subtree n and returns new root. O(log n) expected
+func (n *rankNode) remove(key rowKey) *rankNode {
+	if n == nil {
+		return nil
+	}
+	switch {
+	case key.less(n.key):
+		n.left = n.left.remove(key)
+	case n.key.less(key):
+		n.right = n.right.remove(key)
+	default:
+		return merge(n.left, n.right)
+	}
+	n.update()
+	return n
+}
+
+// split splits subtree n into nodes with keys less than key and the rest
+func (n *rankNode) split(key rowKey) (*rankNode, *rankNode) {
+	if n == nil {
+		return nil, nil
+	}
+	if n.key.less(key) {
+		left, right := n.right.split(key)
+		n.right = left
+		n.update()
+		return n, right
+	}
+	left, right := n.left.split(key)
+	n.left = right
+	n.update()
+	return left, n
+}
+
+// merge joins subtrees l and r, all keys of l must be less than keys of r
+func merge(l, r *rankNode) *rankNode {
+	if l == nil {
+		return r
+	}
+	if r == nil {
+		return l
+	}
+	if l.priority > r.priority {
+		l.right = merge(l.right, r)
+		l.update()
+		return l
+	}
+	r.left = merge(l, r.left)
+	r.update()
+	return r
+}
+
+// rank returns number of nodes in subtree n with keys less than key. O(log n) expected
+func (n *rankNode) rank(key rowKey) int {
+	rank := 0
+	for n != nil {
+		if n.key.less(key) {
+			rank += n.left.len() + 1
+			n = n.right
+		} else {
+			n = n.left
+		}
+	}
+	return rank
+}
+
+// appendRows appends rows of subtree n to rows in order
+func (n *rankNode) appendRows(rows []LeaderboardRow) []LeaderboardRow {
+	if n == nil {
+		return rows
+	}
+	rows = n.left.appendRows(rows)
+	rows = append(rows, n.row)
+	return n.right.appendRows(rows)
+}
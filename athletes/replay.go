@@ -0,0 +1,143 @@
+package athletes
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gitlab.com/mooncascade/event-timing-server/lineprotocol"
+)
+
+// ReplayRead is a single timing read from replayed log file
+type ReplayRead struct {
+	Line          int    `json:"line"`
+	ChipID        string `json:"chip_id,omitempty"`
+	StartNumber   int    `json:"start_number,omitempty"`
+	TimingPointID string `json:"timing_point_id,omitempty"`
+	ClockTime     string `json:"clock_time,omitempty"`
+	LiveClockTime string `json:"live_clock_time,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// ReplayReport is the reconciliation report of replayed log file against live data
+//
+// Missing reads were not received live and were applied to Leaderboard.
+//
+// Different reads have a clock time which differs from live data, live data is kept.
+//
+// Invalid reads could not be parsed, validated or matched to an athlete.
+//
+// Matched is a number of reads equal to live data, Duplicates is a number of
+// repeated reads of the same chip by the same athlete at the same timing point within
+// the file. Reads are matched to athlete chip was assigned to at their clock time.
+// Logs are written by devices, so clock times are compared with live clock times
+// reported by devices before correction by device clock offset. Missing reads
+// with device_id are corrected by offset of the device when applied.
+// In LapRace finish_line reads are matched against lap splits, reads which
+// are not counted as lap are Duplicates.
+type ReplayReport struct {
+	Total      int          `json:"total"`
+	Matched    int          `json:"matched"`
+	Duplicates int          `json:"duplicates"`
+	Missing    []ReplayRead `json:"missing"`
+	Different  []ReplayRead `json:"different"`
+	Invalid    []ReplayRead `json:"invalid"`
+}
+
+// Replay reads timing log line by line in given format and reconciles it with
+// the current Leaderboard. Only the first read of a chip at a timing point is taken
+// into account, except finish_line reads of LapRace which are all taken into account.
+// Reads missing from live data are passed to processTimingEvent, they are accepted
+// until race results are provisional.
+// Empty lines and lines starting with # are skipped
+func (s Service) Replay(r io.Reader, format lineprotocol.Format) (ReplayReport, error) {
+	report := ReplayReport{Missing: []ReplayRead{}, Different: []ReplayRead{}, Invalid: []ReplayRead{}}
+	seen := map[string]bool{}
+	lapRace := s.leadeboard.LapRace()
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		report.Total++
+
+		read := ReplayRead{Line: lineNumber}
+		e, err := format.Parse(line)
+		if err != nil {
+			read.Error = err.Error()
+			report.Invalid = append(report.Invalid, read)
+			continue
+		}
+		read.ChipID, read.TimingPointID, read.ClockTime = e.ChipID, e.TimingPointID, e.ClockTime
+
+		timingData := timingRequest{ChipID: e.ChipID, TimingPointID: e.TimingPointID, ClockTime: e.ClockTime, DeviceID: e.DeviceID}
+		if err := s.Validate(timingData); err != nil {
+			read.Error = err.Error()
+			report.Invalid = append(report.Invalid, read)
+			continue
+		}
+		row, err := s.leadeboard.FindAt(e.ChipID, e.ClockTime)
+		if errors.As(err, &AtheleteNotFound{}) {
+			read.Error = err.Error()
+			report.Invalid = append(report.Invalid, read)
+			continue
+		}
+		read.StartNumber = row.StartNumber
+
+		lap := lapRace.Enabled && e.TimingPointID == "finish_line"
+		key := fmt.Sprintf("%s/%d/%s", e.ChipID, row.StartNumber, e.TimingPointID)
+		if lap {
+			key += "/" + e.ClockTime
+		}
+		if seen[key] {
+			report.Duplicates++
+			continue
+		}
+		seen[key] = true
+		read.LiveClockTime = reportedClockTime(row.Timings.get(e.TimingPointID), row.Timings.getRaw(e.TimingPointID))
+		if lap {
+			read.LiveClockTime = lapClockTime(row, e.ClockTime)
+		}
+		switch {
+		case read.LiveClockTime == "":
+			_, err := s.processRead(timingData, true)
+			if errors.As(err, &LapNotCounted{}) {
+				report.Duplicates++
+				continue
+			}
+			if err != nil {
+				return report, err
+			}
+			report.Missing = append(report.Missing, read)
+		case sameClockTime(read.LiveClockTime, read.ClockTime):
+			report.Matched++
+		default:
+			report.Different = append(report.Different, read)
+		}
+	}
+	return report, scanner.Err()
+}
+
+// reportedClockTime returns clock time as reported by device, rawClockTime if it was corrected
+func reportedClockTime(clockTime, rawClockTime string) string {
+	if rawClockTime != "" {
+		return rawClockTime
+	}
+	return clockTime
+}
+
+// lapClockTime returns clock time reported by device of lap split of row which is the same
+// as clockTime, empty if there is none
+func lapClockTime(row LeaderboardRow, clockTime string) string {
+	for _, split := range row.LapSplits {
+		if reported := reportedClockTime(split.ClockTime, split.ClockTimeRaw); sameClockTime(reported, clockTime) {
+			return reported
+		}
+	}
+	return ""
+}
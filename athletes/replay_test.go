@@ -0,0 +1,123 @@
+package athletes
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/mooncascade/event-timing-server/lineprotocol"
+)
+
+// newTestService returns Service started by the first timing event
+func newTestService(t *testing.T) Service {
+	service, err := NewService(logrus.New(), storeMock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.SetAutoStart(true)
+	return *service
+}
+
+func TestReplay(t *testing.T) {
+	service := newTestService(t)
+	service.leadeboard.FindAndUpdate("d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", "finish_corridor", "00:01:10.1")
+	service.leadeboard.FindAndUpdate("e058c321-b904-46ac-a7fb-9bf0ffeb518e", "finish_corridor", "00:01:11.000")
+
+	log := `# chip_id,timing_point_id,clock_time
+d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17,finish_corridor,00:01:10.100
+e058c321-b904-46ac-a7fb-9bf0ffeb518e,finish_corridor,00:01:11.500
+
+32f637d8-40f9-454e-b7b5-88734865cba2,finish_corridor,00:01:12.212
+32f637d8-40f9-454e-b7b5-88734865cba2,finish_corridor,00:01:12.300
+aaaaaaaa-e63e-442c-98c4-1be4ac871367,finish_corridor,00:01:13
+32f637d8-40f9-454e-b7b5-88734865cba2,start,00:01:13
+broken line
+`
+	report, err := service.Replay(strings.NewReader(log), lineprotocol.DefaultFormat)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 7, report.Total)
+	assert.Equal(t, 1, report.Matched)
+	assert.Equal(t, 1, report.Duplicates)
+	assert.Equal(t, []ReplayRead{
+		{Line: 5, ChipID: "32f637d8-40f9-454e-b7b5-88734865cba2", StartNumber: 3, TimingPointID: "finish_corridor", ClockTime: "00:01:12.212"},
+	}, report.Missing)
+	assert.Equal(t, []ReplayRead{
+		{Line: 3, ChipID: "e058c321-b904-46ac-a7fb-9bf0ffeb518e", StartNumber: 2, TimingPointID: "finish_corridor", ClockTime: "00:01:11.500", LiveClockTime: "00:01:11.000"},
+	}, report.Different)
+	assert.Equal(t, 3, len(report.Invalid))
+	assert.Equal(t, 7, report.Invalid[0].Line)
+	assert.Equal(t, "athlete with chipId: aaaaaaaa-e63e-442c-98c4-1be4ac871367 not found", report.Invalid[0].Error)
+	assert.Equal(t, 8, report.Invalid[1].Line)
+	assert.Equal(t, 9, report.Invalid[2].Line)
+	assert.Equal(t, "expected 3 fields, got 1", report.Invalid[2].Error)
+
+	row, _ := service.leadeboard.Find("32f637d8-40f9-454e-b7b5-88734865cba2")
+	assert.Equal(t, "00:01:12.212", row.FinishCorridor)
+	row, _ = service.leadeboard.Find("e058c321-b904-46ac-a7fb-9bf0ffeb518e")
+	assert.Equal(t, "00:01:11.000", row.FinishCorridor)
+}
+
+func TestReplayWithClockOffset(t *testing.T) {
+	service := newTestService(t)
+	offset := 1500 * time.Millisecond
+	service.devices.Register("mat-1", "finish_line")
+	service.devices.Heartbeat("mat-1", &offset)
+	_, err := service.processTimingEvent(timingRequest{"d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", "finish_line", "00:01:10.123", "mat-1"})
+	assert.Equal(t, nil, err)
+
+	log := `d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17,finish_line,00:01:10.123,mat-1
+e058c321-b904-46ac-a7fb-9bf0ffeb518e,finish_line,00:01:12,mat-1
+`
+	format, err := lineprotocol.ParseFormat("chip_id,timing_point_id,clock_time,device_id", ",", "")
+	assert.Equal(t, nil, err)
+	report, err := service.Replay(strings.NewReader(log), format)
+	assert.Equal(t, nil, err)
+	// Read is matched by clock time reported by device
+	assert.Equal(t, 1, report.Matched)
+	assert.Equal(t, 0, len(report.Different))
+	// Missing read is corrected by offset of its device
+	assert.Equal(t, []ReplayRead{{Line: 2, ChipID: "e058c321-b904-46ac-a7fb-9bf0ffeb518e", StartNumber: 2, TimingPointID: "finish_line", ClockTime: "00:01:12"}}, report.Missing)
+	row, _ := service.leadeboard.Find("e058c321-b904-46ac-a7fb-9bf0ffeb518e")
+	assert.Equal(t, Timings{FinishLine: "00:01:13.5", FinishLineRaw: "00:01:12"}, row.Timings)
+	assert.Equal(t, 2, service.devices.All()[0].Reads)
+}
+
+func TestReplayReassignedChip(t *testing.T) {
+	service := newTestService(t)
+	service.store = &chipStoreMock{chips: map[string]int{}}
+	spareChip := "aaaaaaaa-e63e-442c-98c4-1be4ac871367"
+	clockTime := func() string {
+		time.Sleep(10 * time.Millisecond)
+		defer time.Sleep(10 * time.Millisecond)
+		return time.Now().Format(clockTimeFormat)
+	}
+
+	// Spare chip is read while assigned to John, then reassigned to Jonah
+	_, _, err := service.AssignChip(spareChip, 1, false)
+	assert.Equal(t, nil, err)
+	johnRead := clockTime()
+	_, _, err = service.AssignChip(spareChip, 2, true)
+	assert.Equal(t, nil, err)
+	jonahRead := clockTime()
+
+	log := spareChip + ",finish_corridor," + johnRead + "\n" + spareChip + ",finish_corridor," + jonahRead + "\n"
+	report, err := service.Replay(strings.NewReader(log), lineprotocol.DefaultFormat)
+	assert.Equal(t, nil, err)
+	// Earlier read is credited to John, who had the chip when it was read
+	assert.Equal(t, []ReplayRead{
+		{Line: 1, ChipID: spareChip, StartNumber: 1, TimingPointID: "finish_corridor", ClockTime: johnRead},
+		{Line: 2, ChipID: spareChip, StartNumber: 2, TimingPointID: "finish_corridor", ClockTime: jonahRead},
+	}, report.Missing)
+	row, _ := service.leadeboard.Find("d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17")
+	assert.Equal(t, johnRead, row.FinishCorridor)
+	row, _ = service.leadeboard.Find(spareChip)
+	assert.Equal(t, 2, row.StartNumber)
+	assert.Equal(t, jonahRead, row.FinishCorridor)
+
+	// Replayed again, both reads match live data
+	report, err = service.Replay(strings.NewReader(log), lineprotocol.DefaultFormat)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, report.Matched)
+}
@@ -0,0 +1,177 @@
+package athletes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gitlab.com/mooncascade/event-timing-server/cluster"
+)
+
+// Kinds of replicatedEvent
+const (
+	replicatedTiming       = "timing"
+	replicatedAssignChip   = "assign_chip"
+	replicatedUnassignChip = "unassign_chip"
+	replicatedReloadRoster = "reload_roster"
+	replicatedRace         = "race"
+	replicatedWave         = "wave"
+	replicatedSyncRequest  = "sync_request"
+	replicatedSyncDone     = "sync_done"
+)
+
+// replicatedEvent is a change of leaderboard published to other server instances and written to journal.
+// Timing events are published with clock time already corrected by device clock offset,
+// chip assignments with clock time of the change.
+// Events with SyncID answer sync request of one instance and are skipped by the others
+type replicatedEvent struct {
+	Kind          string `json:"kind"`
+	ChipID        string `json:"chip_id,omitempty"`
+	TimingPointID string `json:"timing_point_id,omitempty"`
+	ClockTime     string `json:"clock_time,omitempty"`
+	RawClockTime  string `json:"raw_clock_time,omitempty"`
+	DeviceID      string `json:"device_id,omitempty"`
+	StartNumber   int    `json:"start_number,omitempty"`
+	RaceState     string `json:"race_state,omitempty"`
+	GunTime       string `json:"gun_time,omitempty"`
+	Wave          string `json:"wave,omitempty"`
+	SyncID        string `json:"sync_id,omitempty"`
+}
+
+// JoinCluster publishes every timing event and chip assignment of the Service to bus
+// and applies events published by other instances to leaderboard. State of other
+// instances is requested on join and on every reconnect of bus, see requestSync.
+// Must be called before handlers of the Service are created
+func (s *Service) JoinCluster(bus cluster.Bus) {
+	s.cluster = bus
+	s.resync = newResync()
+	bus.Subscribe(s.applyReplicated)
+	bus.OnReconnect(s.requestSync)
+	s.requestSync()
+}
+
+// publish records event in journal and sends it to other instances
+func (s Service) publish(event replicatedEvent) {
+	s.record(event)
+	s.send(event)
+}
+
+// send sends event to other instances, failures are only logged as event is already applied locally
+func (s Service) send(event replicatedEvent) {
+	if s.cluster == nil {
+		return
+	}
+	jsonData, err := json.Marshal(event)
+	if err != nil {
+		s.logger.Errorln(err.Error())
+		return
+	}
+	if err := s.cluster.Publish(jsonData); err != nil {
+		s.logger.Errorf("Cluster: publishing %s of chip %s: %v", event.Kind, event.ChipID, err)
+	}
+}
+
+// applyReplicated applies event published by another instance to leaderboard and
+// notifies connected ws clients. Store is not changed as it is shared by all instances.
+// Events answering sync of this instance are applied as well, failures of them are
+// expected for state instance already has
+func (s Service) applyReplicated(msg []byte) {
+	event := replicatedEvent{}
+	if err := json.Unmarshal(msg, &event); err != nil {
+		s.logger.Errorf("Cluster: invalid event: %v", err)
+		return
+	}
+	switch {
+	case event.Kind == replicatedSyncRequest:
+		s.answerSync(event.SyncID)
+		return
+	case event.Kind == replicatedSyncDone:
+		if s.resync.finish(event.SyncID) {
+			s.logger.Infof("Cluster: sync %s done", event.SyncID)
+		}
+		return
+	case event.SyncID != "" && !s.resync.waitingFor(event.SyncID):
+		return
+	}
+	if err := s.applyReplicatedEvent(event); err != nil {
+		if event.SyncID != "" {
+			s.logger.Debugf("Cluster: skipping %s of chip %s from sync: %v", event.Kind, event.ChipID, err)
+			return
+		}
+		s.logger.Errorf("Cluster: applying %s of chip %s: %v", event.Kind, event.ChipID, err)
+		return
+	}
+	event.SyncID = ""
+	s.record(event)
+}
+
+func (s Service) applyReplicatedEvent(event replicatedEvent) error {
+	switch event.Kind {
+	case replicatedTiming:
+		row, err := s.leadeboard.FindAndUpdateCorrected(event.ChipID, event.TimingPointID, event.ClockTime, event.RawClockTime)
+		if errors.As(err, &AtheleteNotFound{}) {
+			s.unmatched.add(UnmatchedRead{
+				ChipID:        event.ChipID,
+				TimingPointID: event.TimingPointID,
+				ClockTime:     event.ClockTime,
+				RawClockTime:  event.RawClockTime,
+				DeviceID:      event.DeviceID,
+				ReceivedAt:    time.Now(),
+			})
+			return nil
+		}
+		if errors.As(err, &LapNotCounted{}) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		s.broadcastRow(row)
+	case replicatedAssignChip:
+		if previous, err := s.leadeboard.Find(event.ChipID); err == nil && previous.StartNumber != event.StartNumber {
+			if _, err := s.leadeboard.UnassignChip(event.ChipID, event.ClockTime); err != nil {
+				return err
+			}
+		}
+		row, err := s.leadeboard.AssignChip(event.ChipID, event.StartNumber, event.ClockTime)
+		if err != nil {
+			return err
+		}
+		if err := s.storeChip(event.ChipID, event.StartNumber, event.ClockTime); err != nil {
+			return err
+		}
+		row, _, err = s.applyUnmatched(event.ChipID, row)
+		if err != nil {
+			return err
+		}
+		s.broadcastRow(row)
+	case replicatedUnassignChip:
+		if _, err := s.leadeboard.UnassignChip(event.ChipID, event.ClockTime); err != nil && !errors.As(err, &AtheleteNotFound{}) {
+			return err
+		}
+		if err := s.storeChip(event.ChipID, 0, event.ClockTime); err != nil {
+			return err
+		}
+	case replicatedReloadRoster:
+		if _, err := s.reloadRoster(); err != nil {
+			return err
+		}
+	case replicatedRace:
+		race, ok := s.race.advance(event.RaceState, event.GunTime)
+		if !ok {
+			return fmt.Errorf("race state %q does not follow %s", event.RaceState, race.State)
+		}
+		s.broadcastRace(race)
+		s.updateStarts()
+	case replicatedWave:
+		wave, err := s.waves.start(event.Wave, event.GunTime)
+		if err != nil {
+			return err
+		}
+		s.waveStarted(wave)
+	default:
+		return fmt.Errorf("unknown kind %q", event.Kind)
+	}
+	return nil
+}
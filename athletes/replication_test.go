@@ -0,0 +1,147 @@
+package athletes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/mooncascade/event-timing-server/cluster"
+)
+
+// memoryBus delivers published messages to handlers of all other buses of the hub.
+// Bus without handler is disconnected
+type memoryBus struct {
+	hub         *[]*memoryBus
+	handler     cluster.Handler
+	reconnected func()
+}
+
+func newMemoryBuses(n int) []*memoryBus {
+	hub := &[]*memoryBus{}
+	for i := 0; i < n; i++ {
+		*hub = append(*hub, &memoryBus{hub: hub})
+	}
+	return *hub
+}
+
+func (b *memoryBus) Publish(msg []byte) error {
+	for _, other := range *b.hub {
+		if other != b && other.handler != nil {
+			other.handler(msg)
+		}
+	}
+	return nil
+}
+
+func (b *memoryBus) Subscribe(handler cluster.Handler) { b.handler = handler }
+func (b *memoryBus) OnReconnect(reconnected func())    { b.reconnected = reconnected }
+func (b *memoryBus) Close()                            {}
+
+// reconnect connects bus with handler as Bus does after connection was lost
+func (b *memoryBus) reconnect(handler cluster.Handler) {
+	b.handler = handler
+	b.reconnected()
+}
+
+func TestReplication(t *testing.T) {
+	buses := newMemoryBuses(2)
+	a, b := newTestService(t), newTestService(t)
+	a.JoinCluster(buses[0])
+	b.JoinCluster(buses[1])
+	johnChip := "d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17"
+	spareChip := "aaaaaaaa-e63e-442c-98c4-1be4ac871367"
+
+	// Timing event received by a is applied by b, race is started by both
+	_, err := a.processTimingEvent(timingRequest{johnChip, "finish_corridor", "00:01:10", ""})
+	assert.Equal(t, nil, err)
+	row, err := b.leadeboard.Find(johnChip)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "00:01:10", row.FinishCorridor)
+	assert.Equal(t, RaceStarted, b.race.get().State)
+
+	// Read of unknown chip is quarantined by both instances
+	_, err = b.processTimingEvent(timingRequest{spareChip, "finish_line", "00:01:15", ""})
+	assert.Equal(t, ReadQuarantined{spareChip}, err)
+	assert.Equal(t, 1, len(a.unmatched.all()))
+
+	// Chip assigned by b is assigned by a, quarantined read is applied by both
+	_, reads, err := b.AssignChip(spareChip, 1, false)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(reads))
+	assert.Equal(t, 0, len(a.unmatched.all()))
+	assert.Equal(t, b.leadeboard.CurrentState(), a.leadeboard.CurrentState())
+	row, err = a.leadeboard.Find(spareChip)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "00:01:15", row.FinishLine)
+
+	// Chip reassigned and unassigned by a
+	_, _, err = a.AssignChip(spareChip, 2, true)
+	assert.Equal(t, nil, err)
+	row, err = b.leadeboard.Find(spareChip)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, row.StartNumber)
+	_, err = a.UnassignChip(spareChip)
+	assert.Equal(t, nil, err)
+	_, err = b.leadeboard.Find(spareChip)
+	assert.Equal(t, AtheleteNotFound{spareChip}, err)
+
+	// Invalid events are not published
+	raeChip := "15c95b2b-e63e-442c-98c4-1be4ac871367"
+	_, err = a.processTimingEvent(timingRequest{raeChip, "finish_line", "1:15", ""})
+	assert.Equal(t, true, err != nil)
+	row, _ = b.leadeboard.Find(raeChip)
+	assert.Equal(t, "", row.FinishLine)
+
+	// Finish closed by b is closed by a
+	_, err = b.TransitionRace("finish", "")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, RaceFinished, a.race.get().State)
+	_, err = a.processTimingEvent(timingRequest{raeChip, "finish_line", "00:01:20", ""})
+	assert.Equal(t, RaceNotOpen{RaceFinished}, err)
+}
+
+func TestResync(t *testing.T) {
+	timeout := syncTimeout
+	syncTimeout = 50 * time.Millisecond
+	defer func() { syncTimeout = timeout }()
+	buses := newMemoryBuses(2)
+	a, b := newTestService(t), newTestService(t)
+	johnChip := "d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17"
+	jonahChip := "e058c321-b904-46ac-a7fb-9bf0ffeb518e"
+	spareChip := "aaaaaaaa-e63e-442c-98c4-1be4ac871367"
+
+	// Instance is not ready until sync request is answered or timed out
+	a.JoinCluster(buses[0])
+	assert.Equal(t, ReadinessCheck{CheckFailed, "waiting for sync with other instances"}, a.Readiness().Checks["cluster"])
+	assert.Eventually(t, func() bool { return a.Readiness().Ready }, time.Second, 10*time.Millisecond)
+
+	_, err := a.processTimingEvent(timingRequest{johnChip, "finish_corridor", "00:01:10", ""})
+	assert.Equal(t, nil, err)
+	_, err = a.processTimingEvent(timingRequest{johnChip, "finish_line", "00:01:14", ""})
+	assert.Equal(t, nil, err)
+	_, err = a.processTimingEvent(timingRequest{spareChip, "finish_line", "00:01:15", ""})
+	assert.Equal(t, ReadQuarantined{spareChip}, err)
+
+	// Instance joining during race receives state of the others
+	b.JoinCluster(buses[1])
+	assert.Equal(t, true, b.Readiness().Ready)
+	assert.Equal(t, a.leadeboard.CurrentState(), b.leadeboard.CurrentState())
+	assert.Equal(t, RaceStarted, b.race.get().State)
+	assert.Equal(t, 1, len(b.unmatched.all()))
+
+	// Events published while instance was disconnected are received on reconnect
+	handler := buses[1].handler
+	buses[1].handler = nil
+	_, err = a.processTimingEvent(timingRequest{jonahChip, "finish_corridor", "00:01:11", ""})
+	assert.Equal(t, nil, err)
+	_, err = a.TransitionRace("finish", "")
+	assert.Equal(t, nil, err)
+	row, _ := b.leadeboard.Find(jonahChip)
+	assert.Equal(t, "", row.FinishCorridor)
+	buses[1].reconnect(handler)
+	assert.Equal(t, true, b.Readiness().Ready)
+	assert.Equal(t, a.leadeboard.CurrentState(), b.leadeboard.CurrentState())
+	assert.Equal(t, RaceFinished, b.race.get().State)
+	assert.Equal(t, 1, len(b.unmatched.all()))
+	assert.Equal(t, 1, len(a.unmatched.all()))
+}
@@ -0,0 +1,164 @@
+package athletes
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// syncTimeout is the time to wait for other instances to answer sync request.
+// Instance is considered synced if none answered, e.g. it is the only one running
+var syncTimeout = 5 * time.Second
+
+// resync tracks sync of leaderboard with other instances after joining cluster
+// or reconnecting to it. pending is ID of sync requested, empty once synced
+type resync struct {
+	mu      sync.Mutex
+	pending string
+	timer   *time.Timer
+}
+
+func newResync() *resync {
+	return &resync{}
+}
+
+// start sets id as pending sync, timeout is called if it is not finished within syncTimeout
+func (r *resync) start(id string, timeout func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	r.pending = id
+	r.timer = time.AfterFunc(syncTimeout, timeout)
+}
+
+// finish marks sync with id done, returns false if id is not pending
+func (r *resync) finish(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id == "" || r.pending != id {
+		return false
+	}
+	r.timer.Stop()
+	r.pending = ""
+	return true
+}
+
+// waitingFor reports whether id is pending sync
+func (r *resync) waitingFor(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return id != "" && r.pending == id
+}
+
+func (r *resync) synced() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pending == ""
+}
+
+// requestSync asks other instances for their state, events published while instance
+// was not listening are lost otherwise. Instance is not ready until the first answer
+// arrived or syncTimeout passed
+func (s Service) requestSync() {
+	id := uuid.New().String()
+	s.resync.start(id, func() {
+		if s.resync.finish(id) {
+			s.logger.Warnf("Cluster: sync %s was not answered within %v, continuing with own state", id, syncTimeout)
+		}
+	})
+	s.logger.Infof("Cluster: requesting sync %s", id)
+	s.send(replicatedEvent{Kind: replicatedSyncRequest, SyncID: id})
+}
+
+// answerSync sends state of the Service to instance which requested sync with id as
+// events addressed to it, followed by replicatedSyncDone. Instances waiting for sync
+// themselves do not answer as their state may be incomplete
+func (s Service) answerSync(id string) {
+	if !s.resync.synced() {
+		return
+	}
+	for _, event := range s.syncEvents() {
+		event.SyncID = id
+		s.send(event)
+	}
+	s.send(replicatedEvent{Kind: replicatedSyncDone, SyncID: id})
+}
+
+// syncEvents returns events which bring other instance to current state of the Service:
+// roster reload picking up chip assignments from shared store, current chip assignments
+// for private stores, race, started waves, timings of athletes with chip and quarantined reads
+func (s Service) syncEvents() []replicatedEvent {
+	events := []replicatedEvent{{Kind: replicatedReloadRoster}}
+	if !s.sharedStore() {
+		events = append(events, s.chipEvents()...)
+	}
+	if race := s.race.get(); race.State != RaceScheduled {
+		events = append(events, replicatedEvent{Kind: replicatedRace, RaceState: race.State, GunTime: race.GunTime})
+	}
+	for _, wave := range s.waves.all() {
+		if wave.GunTime != "" {
+			events = append(events, replicatedEvent{Kind: replicatedWave, Wave: wave.ID, GunTime: wave.GunTime})
+		}
+	}
+	timing := func(chipID, timingPointID, clockTime, rawClockTime, deviceID string) replicatedEvent {
+		return replicatedEvent{
+			Kind:          replicatedTiming,
+			ChipID:        chipID,
+			TimingPointID: timingPointID,
+			ClockTime:     clockTime,
+			RawClockTime:  rawClockTime,
+			DeviceID:      deviceID,
+		}
+	}
+	for _, row := range s.leadeboard.CurrentState() {
+		if row.ChipID == "" {
+			continue
+		}
+		if row.FinishCorridor != "" {
+			events = append(events, timing(row.ChipID, "finish_corridor", row.FinishCorridor, row.FinishCorridorRaw, ""))
+		}
+		for i := 0; i < len(row.LapSplits)-1; i++ {
+			events = append(events, timing(row.ChipID, "finish_line", row.LapSplits[i].ClockTime, row.LapSplits[i].ClockTimeRaw, ""))
+		}
+		if row.FinishLine != "" {
+			events = append(events, timing(row.ChipID, "finish_line", row.FinishLine, row.FinishLineRaw, ""))
+		}
+	}
+	for _, read := range s.unmatched.all() {
+		events = append(events, timing(read.ChipID, read.TimingPointID, read.ClockTime, read.RawClockTime, read.DeviceID))
+	}
+	return events
+}
+
+// chipEvents returns assignments of currently assigned chips of store with clock time
+// they were assigned at, assignments made before today start at midnight
+func (s Service) chipEvents() []replicatedEvent {
+	chips, err := s.store.FindChips()
+	if err != nil {
+		s.logger.Errorf("Cluster: reading chips for sync: %v", err)
+		return nil
+	}
+	now := time.Now()
+	events := []replicatedEvent{}
+	for _, c := range chips.current() {
+		events = append(events, replicatedEvent{
+			Kind:        replicatedAssignChip,
+			ChipID:      c.ChipID,
+			StartNumber: c.StartNumber,
+			ClockTime:   time.Time{}.Add(sinceMidnight(c.ValidFrom, now)).Format(clockTimeFormat),
+		})
+	}
+	return events
+}
+
+// checkCluster fails while instance waits for sync with other instances
+func (s Service) checkCluster() error {
+	if !s.resync.synced() {
+		return fmt.Errorf("waiting for sync with other instances")
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package athletes
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// ReloadRoster reads athletes and chips from store and merges them into leaderboard
+// without losing timings of existing athletes, see Leaderboard.Reload. Quarantined reads
+// of chips which became known are applied. If roster changed, all connected ws clients
+// receive the whole leaderboard and other instances of the cluster reload their roster
+func (s Service) ReloadRoster() (RosterChanges, error) {
+	changes, err := s.reloadRoster()
+	if err != nil {
+		return changes, err
+	}
+	if !changes.empty() {
+		s.publish(replicatedEvent{Kind: replicatedReloadRoster})
+	}
+	return changes, nil
+}
+
+func (s Service) reloadRoster() (RosterChanges, error) {
+	athletes, err := s.store.FindAll()
+	if err != nil {
+		return RosterChanges{}, err
+	}
+	if len(athletes) == 0 {
+		return RosterChanges{}, fmt.Errorf("athletes table is empty")
+	}
+	chips, err := s.store.FindChips()
+	if err != nil {
+		return RosterChanges{}, err
+	}
+	changes := s.leadeboard.Reload(athletes, chips)
+	for _, read := range s.unmatched.all() {
+		row, err := s.leadeboard.Find(read.ChipID)
+		if err != nil {
+			continue
+		}
+		if _, _, err := s.applyUnmatched(read.ChipID, row); err != nil {
+			return changes, err
+		}
+		if !containsStartNumber(changes.Added, row.StartNumber) && !containsStartNumber(changes.Updated, row.StartNumber) {
+			changes.Updated = append(changes.Updated, row.StartNumber)
+		}
+	}
+	if changes.empty() {
+		return changes, nil
+	}
+	s.logger.Infof("Roster reloaded: %d added, %d updated, %d removed", len(changes.Added), len(changes.Updated), len(changes.Removed))
+	jsonData, err := json.Marshal(s.leadeboard.CurrentState())
+	if err != nil {
+		return changes, err
+	}
+	s.wsManager.SendMessageToAll(jsonData)
+	return changes, nil
+}
+
+func containsStartNumber(startNumbers []int, startNumber int) bool {
+	for _, n := range startNumbers {
+		if n == startNumber {
+			return true
+		}
+	}
+	return false
+}
+
+// ReloadRosterHandler passes request to Service.ReloadRoster and responds with RosterChanges
+func (s Service) ReloadRosterHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		changes, err := s.ReloadRoster()
+		if err != nil {
+			s.requestLogger(r).Errorln(err.Error())
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		jsonData, err := json.Marshal(changes)
+		if err != nil {
+			s.requestLogger(r).Errorln(err.Error())
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, jsonData, http.StatusOK)
+	}
+}
+
+// rosterEntry is an athlete in roster file
+type rosterEntry struct {
+	FirstName   string `json:"first_name" validate:"required,max=64"`
+	LastName    string `json:"last_name" validate:"required,max=64"`
+	StartNumber int    `json:"start_number" validate:"required,min=1"`
+	ChipID      string `json:"chip_id" validate:"omitempty,uuid4"`
+	Wave        string `json:"wave" validate:"max=32"`
+}
+
+// rosterColumns are columns of CSV roster file, chip_id and wave are optional
+var rosterColumns = []string{"first_name", "last_name", "start_number", "chip_id", "wave"}
+
+// ReadRoster reads athletes from JSON file with array of objects or CSV file with header
+// of first_name, last_name, start_number, chip_id and wave columns in any order.
+// Format is selected by file extension
+func ReadRoster(path string) (Athletes, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var entries []rosterEntry
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.NewDecoder(file).Decode(&entries)
+	} else {
+		entries, err = readRosterCSV(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("roster %s: %w", path, err)
+	}
+
+	v := validator.New()
+	athletes := Athletes{}
+	for i, e := range entries {
+		if err := v.Struct(e); err != nil {
+			return nil, fmt.Errorf("roster %s: athlete %d: %w", path, i+1, err)
+		}
+		athletes = append(athletes, Athlete{e.FirstName, e.LastName, e.ChipID, e.StartNumber, e.Wave})
+	}
+	return athletes, nil
+}
+
+func readRosterCSV(r io.Reader) ([]rosterEntry, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range rosterColumns[:3] {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing %s column", name)
+		}
+	}
+
+	entries := []rosterEntry{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		startNumber, err := strconv.Atoi(record[columns["start_number"]])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid start_number: %w", len(entries)+2, err)
+		}
+		e := rosterEntry{
+			FirstName:   record[columns["first_name"]],
+			LastName:    record[columns["last_name"]],
+			StartNumber: startNumber,
+		}
+		if i, ok := columns["chip_id"]; ok {
+			e.ChipID = record[i]
+		}
+		if i, ok := columns["wave"]; ok {
+			e.Wave = strings.TrimSpace(record[i])
+		}
+		entries = append(entries, e)
+	}
+}
@@ -0,0 +1,111 @@
+package athletes
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rosterStoreMock returns athletes and chips which can be changed by test
+type rosterStoreMock struct {
+	storeMock
+	athletes Athletes
+	chips    Chips
+}
+
+func (s *rosterStoreMock) FindAll() (Athletes, error) { return s.athletes, nil }
+func (s *rosterStoreMock) FindChips() (Chips, error)  { return s.chips, nil }
+
+func TestReloadRoster(t *testing.T) {
+	athletes, _ := storeMock{}.FindAll()
+	store := &rosterStoreMock{athletes: athletes, chips: Chips{}}
+	service := newTestService(t)
+	service.store = store
+	johnChip := "d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17"
+	newChip := "aaaaaaaa-e63e-442c-98c4-1be4ac871367"
+
+	_, err := service.processTimingEvent(timingRequest{johnChip, "finish_corridor", "00:01:10", ""})
+	assert.Equal(t, nil, err)
+	_, err = service.processTimingEvent(timingRequest{newChip, "finish_corridor", "00:01:11", ""})
+	assert.Equal(t, ReadQuarantined{newChip}, err)
+
+	// Nothing changed
+	changes, err := service.ReloadRoster()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, RosterChanges{[]int{}, []int{}, []int{}}, changes)
+
+	// Jonah renamed, Rae removed and athlete with quarantined read added
+	store.athletes = Athletes{
+		athletes[0],
+		Athlete{"Jonah", "Hubbard-Smith", athletes[1].ChipID, 2, ""},
+		athletes[2],
+		Athlete{"Mary", "Major", newChip, 5, ""},
+	}
+	w := httptest.NewRecorder()
+	service.ReloadRosterHandler()(w, httptest.NewRequest("POST", "/admin/roster/reload", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, nil, json.Unmarshal(w.Body.Bytes(), &changes))
+	assert.Equal(t, RosterChanges{[]int{5}, []int{2}, []int{4}}, changes)
+
+	state := service.leadeboard.CurrentState()
+	assert.Equal(t, 4, len(state))
+	assert.Equal(t, "John", state[0].FirstName)
+	assert.Equal(t, "00:01:10", state[0].FinishCorridor)
+	assert.Equal(t, "Mary", state[1].FirstName)
+	assert.Equal(t, "00:01:11", state[1].FinishCorridor)
+	assert.Equal(t, "Hubbard-Smith", state[2].LastName)
+	assert.Equal(t, 0, len(service.unmatched.all()))
+	_, err = service.leadeboard.Find(athletes[3].ChipID)
+	assert.Equal(t, AtheleteNotFound{athletes[3].ChipID}, err)
+
+	// Empty roster is rejected
+	store.athletes = Athletes{}
+	_, err = service.ReloadRoster()
+	assert.Equal(t, "athletes table is empty", err.Error())
+	assert.Equal(t, 4, len(service.leadeboard.CurrentState()))
+}
+
+func TestReadRoster(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	expected := Athletes{
+		Athlete{"John", "Doe", "d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", 1, ""},
+		Athlete{"Jonah", "Hubbard", "", 2, "B"},
+	}
+
+	athletes, err := ReadRoster(write("athletes.csv", `start_number, first_name, last_name, chip_id, wave
+1, John, Doe, d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17,
+2, Jonah, Hubbard,, B
+`))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, expected, athletes)
+
+	athletes, err = ReadRoster(write("athletes.json", `[
+		{"first_name": "John", "last_name": "Doe", "start_number": 1, "chip_id": "d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17"},
+		{"first_name": "Jonah", "last_name": "Hubbard", "start_number": 2, "wave": "B"}
+	]`))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, expected, athletes)
+
+	_, err = ReadRoster(write("no_start_number.csv", "first_name,last_name\nJohn,Doe\n"))
+	assert.Equal(t, true, strings.HasSuffix(err.Error(), "missing start_number column"))
+	_, err = ReadRoster(write("invalid_start_number.csv", "first_name,last_name,start_number\nJohn,Doe,one\n"))
+	assert.Equal(t, true, strings.Contains(err.Error(), "line 2: invalid start_number"))
+	_, err = ReadRoster(write("invalid_chip.json", `[{"first_name": "John", "last_name": "Doe", "start_number": 1, "chip_id": "chip1"}]`))
+	assert.Equal(t, true, strings.Contains(err.Error(), "athlete 1"))
+	_, err = ReadRoster(filepath.Join(dir, "missing.csv"))
+	assert.Equal(t, true, os.IsNotExist(err))
+}
@@ -0,0 +1,92 @@
+package athletes
+
+import (
+	"time"
+)
+
+// Flags set on LeaderboardRow when its timings break Rules
+const (
+	FlagMissingFinishCorridor = "missing_finish_corridor"
+	FlagWrongOrder            = "finish_line_before_finish_corridor"
+	FlagGapTooShort           = "gap_too_short"
+	FlagGapTooLong            = "gap_too_long"
+	FlagImpossiblePace        = "impossible_pace"
+)
+
+// Rules are consistency checks between finish_corridor and finish_line times
+//
+// RequireCorridor flags finish_line time without finish_corridor time.
+//
+// Ordering flags finish_line time earlier than finish_corridor time.
+//
+// MinGap and MaxGap limit time between finish_corridor and finish_line, zero disables the check.
+//
+// CorridorLength in meters and MaxSpeed in meters per second flag athletes who covered
+// finish corridor faster than humanly possible, zero disables the check.
+type Rules struct {
+	RequireCorridor bool
+	Ordering        bool
+	MinGap          time.Duration
+	MaxGap          time.Duration
+	CorridorLength  float64
+	MaxSpeed        float64
+}
+
+// DefaultRules only check presence and order of timing points
+var DefaultRules = Rules{RequireCorridor: true, Ordering: true}
+
+// Check returns flags for all broken rules, nil if timings are consistent
+func (r Rules) Check(t Timings) []string {
+	if t.FinishLine == "" {
+		return nil
+	}
+	if t.FinishCorridor == "" {
+		if r.RequireCorridor {
+			return []string{FlagMissingFinishCorridor}
+		}
+		return nil
+	}
+
+	gap, err := clockTimeDiff(t.FinishCorridor, t.FinishLine)
+	if err != nil {
+		return nil
+	}
+	var flags []string
+	if gap < 0 {
+		if r.Ordering {
+			flags = append(flags, FlagWrongOrder)
+		}
+		return flags
+	}
+	if r.MinGap > 0 && gap < r.MinGap {
+		flags = append(flags, FlagGapTooShort)
+	}
+	if r.MaxGap > 0 && gap > r.MaxGap {
+		flags = append(flags, FlagGapTooLong)
+	}
+	if r.CorridorLength > 0 && r.MaxSpeed > 0 && r.CorridorLength > r.MaxSpeed*gap.Seconds() {
+		flags = append(flags, FlagImpossiblePace)
+	}
+	return flags
+}
+
+// clockTimeDiff returns duration from clock time a to clock time b normalized
+// to be within 12 hours to handle midnight
+func clockTimeDiff(a, b string) (time.Duration, error) {
+	aTime, err := time.Parse(clockTimeFormat, a)
+	if err != nil {
+		return 0, err
+	}
+	bTime, err := time.Parse(clockTimeFormat, b)
+	if err != nil {
+		return 0, err
+	}
+	diff := bTime.Sub(aTime)
+	switch {
+	case diff > 12*time.Hour:
+		diff -= 24 * time.Hour
+	case diff < -12*time.Hour:
+		diff += 24 * time.Hour
+	}
+	return diff, nil
+}
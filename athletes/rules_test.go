@@ -0,0 +1,56 @@
+package athletes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRulesCheck(t *testing.T) {
+	rules := Rules{
+		RequireCorridor: true,
+		Ordering:        true,
+		MinGap:          2 * time.Second,
+		MaxGap:          time.Minute,
+		CorridorLength:  20,
+		MaxSpeed:        8,
+	}
+	var cases = []struct {
+		timings Timings
+		flags   []string
+	}{
+		{Timings{}, nil},
+		{Timings{FinishCorridor: "00:01:10"}, nil},
+		{Timings{FinishCorridor: "00:01:10", FinishLine: "00:01:15"}, nil},
+		{Timings{FinishLine: "00:01:15"}, []string{FlagMissingFinishCorridor}},
+		{Timings{FinishCorridor: "00:01:15", FinishLine: "00:01:10"}, []string{FlagWrongOrder}},
+		{Timings{FinishCorridor: "00:01:10", FinishLine: "00:01:11.5"}, []string{FlagGapTooShort, FlagImpossiblePace}},
+		{Timings{FinishCorridor: "00:01:10", FinishLine: "00:01:12"}, []string{FlagImpossiblePace}},
+		{Timings{FinishCorridor: "00:01:10", FinishLine: "00:02:10.001"}, []string{FlagGapTooLong}},
+		{Timings{FinishCorridor: "23:59:58", FinishLine: "00:00:03"}, nil},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.flags, rules.Check(c.timings), c.timings)
+	}
+
+	// Disabled rules
+	assert.Equal(t, []string(nil), Rules{}.Check(Timings{FinishLine: "00:01:15"}))
+	assert.Equal(t, []string(nil), Rules{}.Check(Timings{FinishCorridor: "00:01:15", FinishLine: "00:01:10"}))
+	assert.Equal(t, []string(nil), Rules{}.Check(Timings{FinishCorridor: "00:01:10", FinishLine: "00:01:10.5"}))
+}
+
+func TestLeaderboardRules(t *testing.T) {
+	leaderboard, _ := newLeaderboard(&storeMock{})
+	row, err := leaderboard.FindAndUpdate("d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", "finish_line", "00:01:10.123")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{FlagMissingFinishCorridor}, row.Flags)
+
+	row, err = leaderboard.FindAndUpdate("d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", "finish_corridor", "00:01:11")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{FlagWrongOrder}, row.Flags)
+
+	leaderboard.SetRules(Rules{})
+	row, _ = leaderboard.Find("d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17")
+	assert.Equal(t, []string(nil), row.Flags)
+}
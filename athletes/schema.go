@@ -9,7 +9,7 @@ import (
 	"gitlab.com/mooncascade/event-timing-server/athletes/migrations"
 )
 
-const version = 1
+const version = 3
 
 // Migrate migrates the Postgres schema to the current version.
 func validateSchema(db *sql.DB) error {
@@ -1,38 +1,104 @@
 package athletes
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/sirupsen/logrus"
+	"gitlab.com/mooncascade/event-timing-server/cluster"
+	"gitlab.com/mooncascade/event-timing-server/devices"
 	"gitlab.com/mooncascade/event-timing-server/websocket"
 )
 
 // Service contains store and validator for Athletes service
 type Service struct {
 	validator  *validator.Validate
-	leadeboard Leaderboard
+	leadeboard *leaderboard
 	logger     *logrus.Logger
 	wsManager  websocket.WSManager
+	wsLogger   *logrus.Logger
+	devices    devices.Registry
+	unmatched  *quarantine
+	race       *race
+	waves      *waves
+	store      Store
+	cluster    cluster.Bus
+	journal    *journal
+	resync     *resync
 }
 
 // InitService initiates store, leaderboard, WSManager and returns Service
-func InitService(logger *logrus.Logger, connectionString string) (*Service, error) {
-	store, err := NewStore(connectionString)
+func InitService(logger *logrus.Logger, connectionString string, options ...StoreOption) (*Service, error) {
+	store, err := NewStore(connectionString, options...)
 	if err != nil {
 		return nil, fmt.Errorf("store init failed: %w", err)
 	}
-	defer store.Close()
-	l, err := NewLeaderboard(store)
+	return NewService(logger, store)
+}
+
+// NewService initiates leaderboard from store, WSManager and returns Service.
+// Store is closed if leaderboard init failed
+func NewService(logger *logrus.Logger, store Store) (*Service, error) {
+	l, err := newLeaderboard(store)
 	if err != nil {
+		store.Close()
 		return nil, fmt.Errorf("leaderboard init failed: %w", err)
 	}
 	wsManager := websocket.NewWSManager()
-	service := &Service{validator.New(), l, logger, wsManager}
+	service := &Service{
+		validator:  validator.New(),
+		leadeboard: l,
+		logger:     logger,
+		wsManager:  wsManager,
+		wsLogger:   logger,
+		devices:    devices.NewRegistry(),
+		unmatched:  newQuarantine(),
+		race:       newRace(),
+		waves:      newWaves(),
+		store:      store,
+	}
 	return service, nil
 }
 
+// Close closes cluster bus, journal and store of the Service
+func (s Service) Close() {
+	if s.cluster != nil {
+		s.cluster.Close()
+	}
+	if s.journal != nil {
+		s.journal.close()
+	}
+	s.store.Close()
+}
+
+// ShutdownReason is sent to WebSocket clients in close frame when server shuts down
+const ShutdownReason = "server restarting"
+
+// Shutdown disconnects all WebSocket clients with ShutdownReason. Should be called
+// once no timing events are processed, store is still open until Close is called
+func (s Service) Shutdown(ctx context.Context) error {
+	return s.wsManager.Shutdown(ctx, ShutdownReason)
+}
+
 // Validate validates t
 func (s Service) Validate(t interface{}) error {
 	return s.validator.Struct(t)
 }
+
+// SetRules sets consistency Rules for timing points of Leaderboard
+func (s Service) SetRules(rules Rules) {
+	s.leadeboard.SetRules(rules)
+}
+
+// SetWebSocketLogger sets logger of WebSocket clients, one of every sampling outbound
+// messages is logged at debug level. Must be called before handlers of the Service are created
+func (s *Service) SetWebSocketLogger(logger *logrus.Logger, sampling int) {
+	s.wsLogger = logger
+	s.wsManager.SetMessageSampling(sampling)
+}
+
+// SetWebSocketLimits sets limits of WebSocket clients connecting to WSHandler
+func (s Service) SetWebSocketLimits(limits websocket.Limits) {
+	s.wsManager.SetLimits(limits)
+}
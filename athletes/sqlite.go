@@ -0,0 +1,201 @@
+package athletes
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"gitlab.com/mooncascade/event-timing-server/metrics"
+	// Registers "sqlite" database/sql driver
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema creates tables of the current schema version. SQLite schema is not migrated,
+// databases created by another version of server are rejected
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS athletes (
+	first_name varchar(64) NOT NULL,
+	last_name varchar(64) NOT NULL,
+	start_number integer PRIMARY KEY,
+	wave varchar(32) NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS chips (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	chip_id text NOT NULL,
+	start_number integer NOT NULL REFERENCES athletes (start_number) ON DELETE CASCADE,
+	valid_from timestamp NOT NULL,
+	valid_to timestamp
+);
+CREATE UNIQUE INDEX IF NOT EXISTS chips_active_chip_id_idx ON chips (chip_id) WHERE valid_to IS NULL;
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version bigint PRIMARY KEY,
+	dirty boolean NOT NULL
+);
+`
+
+// sqliteStore implements Store using embedded SQLite database.
+// Queries are the same as of store, except for placeholders and lateral join
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// newSQLiteStore opens SQLite database file at path, creating it if it does not exist
+func newSQLiteStore(path string) (Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite has a single writer, also keeps ":memory:" database in one connection
+	db.SetMaxOpenConns(1)
+	if err := initSQLiteSchema(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("db schema validation: %w", err)
+	}
+	return &sqliteStore{db}, nil
+}
+
+func initSQLiteSchema(db *sql.DB) error {
+	if _, err := db.Exec("PRAGMA foreign_keys = ON"); err != nil {
+		return err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		return err
+	}
+	if _, err := db.Exec("INSERT OR IGNORE INTO schema_migrations (version, dirty) VALUES (?, false)", version); err != nil {
+		return err
+	}
+	s := sqliteStore{db}
+	applied, _, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if applied != version {
+		return fmt.Errorf("unsupported schema version %d, expected %d", applied, version)
+	}
+	return nil
+}
+
+func (s sqliteStore) Close() {
+	s.db.Close()
+}
+
+func (s sqliteStore) Ping() error {
+	defer metrics.ObserveQuery("ping")()
+	return s.db.Ping()
+}
+
+func (s sqliteStore) SchemaVersion() (uint, bool, error) {
+	defer metrics.ObserveQuery("schema_version")()
+	var version uint
+	var dirty bool
+	err := s.db.QueryRow(schemaVersionQuery).Scan(&version, &dirty)
+	return version, dirty, err
+}
+
+const sqliteFindAllQuery = `
+SELECT
+	a.first_name,
+	a.last_name,
+	COALESCE((
+		SELECT chip_id
+		FROM chips c
+		WHERE c.start_number = a.start_number AND c.valid_to IS NULL
+		ORDER BY c.valid_from, c.id
+		LIMIT 1
+	), ''),
+	a.start_number,
+	a.wave
+FROM athletes a
+ORDER BY a.start_number
+`
+
+func (s sqliteStore) FindAll() (Athletes, error) {
+	defer metrics.ObserveQuery("find_all")()
+	aSlice := Athletes{}
+	rows, err := s.db.Query(sqliteFindAllQuery)
+	if err != nil {
+		return aSlice, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		a := Athlete{}
+		if err := rows.Scan(&a.FirstName, &a.LastName, &a.ChipID, &a.StartNumber, &a.Wave); err != nil {
+			return aSlice, err
+		}
+		aSlice = append(aSlice, a)
+	}
+	return aSlice, rows.Err()
+}
+
+const sqliteInsertAthleteQuery = `
+INSERT INTO athletes (first_name, last_name, start_number, wave)
+VALUES (?, ?, ?, ?);
+`
+
+const sqliteInsertChipQuery = `
+INSERT INTO chips (chip_id, start_number, valid_from)
+VALUES (?, ?, ?);
+`
+
+const sqliteUnassignChipQuery = `
+UPDATE chips SET valid_to = ?
+WHERE chip_id = ? AND valid_to IS NULL;
+`
+
+func (s sqliteStore) Add(a Athlete) error {
+	defer metrics.ObserveQuery("add")()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(sqliteInsertAthleteQuery, a.FirstName, a.LastName, a.StartNumber, a.Wave); err != nil {
+		return err
+	}
+	if a.ChipID != "" {
+		if _, err := tx.Exec(sqliteInsertChipQuery, a.ChipID, a.StartNumber, time.Now().UTC()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s sqliteStore) FindChips() (Chips, error) {
+	defer metrics.ObserveQuery("find_chips")()
+	cSlice := Chips{}
+	rows, err := s.db.Query(findChipsQuery)
+	if err != nil {
+		return cSlice, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		c := Chip{}
+		if err := rows.Scan(&c.ChipID, &c.StartNumber, &c.ValidFrom, &c.ValidTo); err != nil {
+			return cSlice, err
+		}
+		cSlice = append(cSlice, c)
+	}
+	return cSlice, rows.Err()
+}
+
+func (s sqliteStore) AssignChip(chipID string, startNumber int, at time.Time) error {
+	defer metrics.ObserveQuery("assign_chip")()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(sqliteUnassignChipQuery, at.UTC(), chipID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(sqliteInsertChipQuery, chipID, startNumber, at.UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s sqliteStore) UnassignChip(chipID string, at time.Time) error {
+	defer metrics.ObserveQuery("unassign_chip")()
+	_, err := s.db.Exec(sqliteUnassignChipQuery, at.UTC(), chipID)
+	return err
+}
@@ -1,39 +1,111 @@
 package athletes
 
 import (
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestStore(t *testing.T) {
-	var athletesSeed = Athletes{
-		Athlete{"John", "Doe", "d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", 1},
-		Athlete{"Jonah", "Hubbard", "e058c321-b904-46ac-a7fb-9bf0ffeb518e", 2},
-		Athlete{"Felicia", "Perez", "32f637d8-40f9-454e-b7b5-88734865cba2", 3},
-	}
-
 	store, err := NewStore(dbConnectionString)
 	assert.Equal(t, nil, err)
+	testStore(t, store)
+
+	// Empty DB
+	store2, err := NewStore(emptyDBConnectionString)
+	assert.Equal(t, nil, err)
+	assert.Implements(t, (*Store)(nil), store2)
+
+	athletes, err := store2.FindAll()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, Athletes{}, athletes)
+	store2.Close()
+}
+
+func TestMemoryStore(t *testing.T) {
+	store, err := NewMemoryStore(Athletes{})
+	assert.Equal(t, nil, err)
+	testStore(t, store)
+
+	store, err = NewStore("memory://")
+	assert.Equal(t, nil, err)
+	athletes, err := store.FindAll()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, demoAthletes, athletes)
+
+	service, err := InitService(logrus.New(), "memory://")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, service.Readiness().Ready)
+	service.Close()
+}
+
+func TestSQLiteStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "event.db")
+	store, err := NewStore("sqlite://" + path)
+	assert.Equal(t, nil, err)
+	testStore(t, store)
+
+	// Data is kept in file
+	store, err = NewStore("sqlite://" + path)
+	assert.Equal(t, nil, err)
+	athletes, err := store.FindAll()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, len(athletes))
+	applied, dirty, err := store.SchemaVersion()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint(version), applied)
+	assert.Equal(t, false, dirty)
+	store.Close()
+}
+
+// testStore checks Store implementation starting with empty store, closes store
+func testStore(t *testing.T, store Store) {
+	var athletesSeed = Athletes{
+		Athlete{"John", "Doe", "d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", 1, ""},
+		Athlete{"Jonah", "Hubbard", "e058c321-b904-46ac-a7fb-9bf0ffeb518e", 2, ""},
+		Athlete{"Felicia", "Perez", "32f637d8-40f9-454e-b7b5-88734865cba2", 3, "B"},
+	}
 	assert.Implements(t, (*Store)(nil), store)
+	assert.Equal(t, nil, store.Ping())
 
 	for _, a := range athletesSeed {
-		err = store.Add(a)
+		err := store.Add(a)
 		assert.Equal(t, nil, err)
 	}
+	assert.NotEqual(t, nil, store.Add(athletesSeed[0]))
 
 	athletes, err := store.FindAll()
 	assert.Equal(t, nil, err)
 	assert.Equal(t, athletesSeed, athletes)
-	store.Close()
 
-	// Empty DB
-	store2, err := NewStore(emptyDBConnectionString)
+	// Chips
+	chips, err := store.FindChips()
 	assert.Equal(t, nil, err)
-	assert.Implements(t, (*Store)(nil), store2)
+	assert.Equal(t, 3, len(chips))
+	assert.Equal(t, "d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", chips[0].ChipID)
+	assert.Equal(t, (*time.Time)(nil), chips[0].ValidTo)
 
-	athletes, err = store2.FindAll()
+	err = store.AssignChip("aaaaaaaa-e63e-442c-98c4-1be4ac871367", 1, time.Now())
 	assert.Equal(t, nil, err)
-	assert.Equal(t, Athletes{}, athletes)
-	store2.Close()
+	err = store.AssignChip("aaaaaaaa-e63e-442c-98c4-1be4ac871367", 2, time.Now())
+	assert.Equal(t, nil, err)
+	assert.NotEqual(t, nil, store.AssignChip("bbbbbbbb-e63e-442c-98c4-1be4ac871367", 99, time.Now()))
+	chips, err = store.FindChips()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 5, len(chips))
+	assert.Equal(t, 1, chips[3].StartNumber)
+	assert.NotEqual(t, (*time.Time)(nil), chips[3].ValidTo)
+	assert.Equal(t, Chip{ChipID: "aaaaaaaa-e63e-442c-98c4-1be4ac871367", StartNumber: 2, ValidFrom: chips[4].ValidFrom}, chips[4])
+	assert.Equal(t, 4, len(chips.current()))
+
+	err = store.UnassignChip("d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", time.Now())
+	assert.Equal(t, nil, err)
+	athletes, err = store.FindAll()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "", athletes[0].ChipID)
+	assert.Equal(t, athletesSeed[1], athletes[1])
+	store.Close()
 }
@@ -0,0 +1,188 @@
+package athletes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"gitlab.com/mooncascade/event-timing-server/devices"
+)
+
+// Statuses of athletes
+const (
+	StatusNotStarted = "not_started"
+	StatusInCorridor = "in_corridor"
+	StatusFinished   = "finished"
+)
+
+// AthleteStatus is the current state of one athlete.
+// Rank is the position on leaderboard starting from 1. PredictedFinish is finish_line
+// time for finished athletes, for athletes in corridor it is estimated by median
+// finish corridor time of finished athletes, empty if it can not be estimated
+type AthleteStatus struct {
+	LeaderboardRow
+	Rank            int     `json:"rank"`
+	Status          string  `json:"status"`
+	Splits          []Split `json:"splits"`
+	PredictedFinish string  `json:"predicted_finish,omitempty"`
+}
+
+// Split is clock time of athlete at timing point. SplitMS is time since
+// previous timing point in milliseconds, not set for the first timing point
+type Split struct {
+	TimingPointID string `json:"timing_point_id"`
+	ClockTime     string `json:"clock_time"`
+	SplitMS       int64  `json:"split_ms,omitempty"`
+}
+
+// rowStatus returns status of athlete by timing points athlete crossed
+func rowStatus(row LeaderboardRow) string {
+	switch {
+	case row.FinishLine != "":
+		return StatusFinished
+	case row.FinishCorridor != "":
+		return StatusInCorridor
+	default:
+		return StatusNotStarted
+	}
+}
+
+// toAthleteStatus returns AthleteStatus of row at rank. corridorTime returns median finish
+// corridor time, it is called only for athletes in corridor
+func toAthleteStatus(row LeaderboardRow, rank int, corridorTime func() (time.Duration, bool)) AthleteStatus {
+	status := AthleteStatus{LeaderboardRow: row, Rank: rank, Status: rowStatus(row), Splits: []Split{}}
+	if row.FinishCorridor != "" {
+		status.Splits = append(status.Splits, Split{TimingPointID: "finish_corridor", ClockTime: row.FinishCorridor})
+	}
+	if row.FinishLine != "" {
+		split := Split{TimingPointID: "finish_line", ClockTime: row.FinishLine}
+		if gap, err := clockTimeDiff(row.FinishCorridor, row.FinishLine); err == nil && row.FinishCorridor != "" {
+			split.SplitMS = gap.Milliseconds()
+		}
+		status.Splits = append(status.Splits, split)
+	}
+
+	switch status.Status {
+	case StatusFinished:
+		status.PredictedFinish = row.FinishLine
+	case StatusInCorridor:
+		if gap, ok := corridorTime(); ok {
+			status.PredictedFinish, _ = devices.CorrectClockTime(row.FinishCorridor, gap)
+		}
+	}
+	return status
+}
+
+// corridorMedian is result of medianCorridorTime for leaderboard version
+type corridorMedian struct {
+	version uint64
+	gap     time.Duration
+	ok      bool
+}
+
+// medianCorridorTime returns median time between finish_corridor and finish_line of
+// finished athletes without flags, false if there are no such athletes
+func medianCorridorTime(rows []LeaderboardRow) (time.Duration, bool) {
+	gaps := []time.Duration{}
+	for _, row := range rows {
+		if row.FinishCorridor == "" || row.FinishLine == "" || len(row.Flags) > 0 {
+			continue
+		}
+		if gap, err := clockTimeDiff(row.FinishCorridor, row.FinishLine); err == nil && gap >= 0 {
+			gaps = append(gaps, gap)
+		}
+	}
+	if len(gaps) == 0 {
+		return 0, false
+	}
+	sort.Slice(gaps, func(i, j int) bool { return gaps[i] < gaps[j] })
+	return gaps[len(gaps)/2], true
+}
+
+// athleteTopic is ws topic of athlete with startNumber
+func athleteTopic(startNumber int) string {
+	return fmt.Sprintf("athlete:%d", startNumber)
+}
+
+// parseStartNumber parses start number from bib
+func parseStartNumber(bib string) (int, error) {
+	startNumber, err := strconv.Atoi(bib)
+	if err != nil || startNumber <= 0 {
+		return 0, fmt.Errorf("bib: expected start number, got %q", bib)
+	}
+	return startNumber, nil
+}
+
+// AthleteHandler responds with AthleteStatus of athlete with start number from bib url parameter.
+// Supports conditional requests the same way as LeaderboardHandler
+func (s Service) AthleteHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		startNumber, err := parseStartNumber(chi.URLParam(r, "bib"))
+		if err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		status, version, err := s.leadeboard.Status(startNumber)
+		if errors.As(err, &StartNumberNotFound{}) {
+			writeError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if notModified(w, r, version) {
+			return
+		}
+		jsonData, err := json.Marshal(status)
+		if err != nil {
+			s.requestLogger(r).Errorln(err.Error())
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, jsonData, http.StatusOK)
+	}
+}
+
+// trackAthlete handles websocket connection of client following athlete with startNumber.
+// Client receives AthleteStatus as first message and after every update of the athlete
+func (s Service) trackAthlete(w http.ResponseWriter, r *http.Request, startNumber int) {
+	status, _, err := s.leadeboard.Status(startNumber)
+	if errors.As(err, &StartNumberNotFound{}) {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	ws, err := s.wsManager.Upgrade(w, r, nil)
+	if err != nil {
+		s.requestLogger(r).Errorln(err.Error())
+		return
+	}
+	clientID := s.wsManager.AddSubscriber(ws, s.wsLogger, athleteTopic(startNumber))
+	jsonData, err := json.Marshal(status)
+	if err != nil {
+		s.requestLogger(r).Errorln(err.Error())
+		return
+	}
+	go s.wsManager.SendMessageToOne(jsonData, clientID)
+	s.wsManager.StartClient(clientID)
+}
+
+// sendAthleteStatus sends AthleteStatus of updated row to clients following the athlete
+func (s Service) sendAthleteStatus(row LeaderboardRow) {
+	topic := athleteTopic(row.StartNumber)
+	if !s.wsManager.HasSubscribers(topic) {
+		return
+	}
+	status, _, err := s.leadeboard.Status(row.StartNumber)
+	if err != nil {
+		s.logger.Errorln(err.Error())
+		return
+	}
+	jsonData, err := json.Marshal(status)
+	if err != nil {
+		s.logger.Errorln(err.Error())
+		return
+	}
+	s.wsManager.SendMessageToTopic(jsonData, topic)
+}
@@ -0,0 +1,115 @@
+package athletes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	gorilla "github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAthleteStatus(t *testing.T) {
+	leaderboard, _ := NewLeaderboard(&storeMock{})
+	leaderboard.FindAndUpdate("d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", "finish_corridor", "00:01:10")
+	leaderboard.FindAndUpdate("d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", "finish_line", "00:01:14.5")
+	leaderboard.FindAndUpdate("e058c321-b904-46ac-a7fb-9bf0ffeb518e", "finish_corridor", "00:01:11")
+	rows, version := leaderboard.Snapshot()
+
+	status, statusVersion, err := leaderboard.Status(1)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, version, statusVersion)
+	assert.Equal(t, 1, status.Rank)
+	assert.Equal(t, StatusFinished, status.Status)
+	assert.Equal(t, []Split{{"finish_corridor", "00:01:10", 0}, {"finish_line", "00:01:14.5", 4500}}, status.Splits)
+	assert.Equal(t, "00:01:14.5", status.PredictedFinish)
+
+	status, _, err = leaderboard.Status(2)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, status.Rank)
+	assert.Equal(t, StatusInCorridor, status.Status)
+	assert.Equal(t, []Split{{"finish_corridor", "00:01:11", 0}}, status.Splits)
+	assert.Equal(t, "00:01:15.5", status.PredictedFinish)
+
+	status, _, err = leaderboard.Status(4)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 4, status.Rank)
+	assert.Equal(t, StatusNotStarted, status.Status)
+	assert.Equal(t, []Split{}, status.Splits)
+	assert.Equal(t, "", status.PredictedFinish)
+
+	_, _, err = leaderboard.Status(42)
+	assert.Equal(t, StartNumberNotFound{42}, err)
+
+	// Rank is the position in CurrentState
+	for i, row := range rows {
+		status, _, _ = leaderboard.Status(row.StartNumber)
+		assert.Equal(t, i+1, status.Rank)
+	}
+
+	// Median corridor time follows leaderboard changes
+	leaderboard.FindAndUpdate("32f637d8-40f9-454e-b7b5-88734865cba2", "finish_corridor", "00:01:12")
+	leaderboard.FindAndUpdate("32f637d8-40f9-454e-b7b5-88734865cba2", "finish_line", "00:01:20")
+	status, _, _ = leaderboard.Status(2)
+	assert.Equal(t, "00:01:19", status.PredictedFinish)
+
+	// No finished athletes to estimate finish
+	leaderboard, _ = NewLeaderboard(&storeMock{})
+	leaderboard.FindAndUpdate("e058c321-b904-46ac-a7fb-9bf0ffeb518e", "finish_corridor", "00:01:11")
+	status, _, _ = leaderboard.Status(2)
+	assert.Equal(t, "", status.PredictedFinish)
+}
+
+func TestAthleteHandler(t *testing.T) {
+	service := newTestService(t)
+	r := chi.NewRouter()
+	r.Get("/athletes/{bib}", service.AthleteHandler())
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/athletes/3", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var status AthleteStatus
+	assert.Equal(t, nil, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, "Felicia", status.FirstName)
+	assert.Equal(t, 3, status.Rank)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/athletes/42", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/athletes/felicia", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestTrackAthlete(t *testing.T) {
+	service := newTestService(t)
+	ts := httptest.NewServer(http.HandlerFunc(service.WSHandler()))
+	defer ts.Close()
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http")
+
+	_, resp, err := gorilla.DefaultDialer.Dial(wsURL+"?bib=42", nil)
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	client, _, err := gorilla.DefaultDialer.Dial(wsURL+"?bib=2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	var status AthleteStatus
+	assert.Equal(t, nil, client.ReadJSON(&status))
+	assert.Equal(t, 2, status.StartNumber)
+	assert.Equal(t, StatusNotStarted, status.Status)
+
+	// Updates of other athletes are not sent
+	service.processTimingEvent(timingRequest{"d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", "finish_corridor", "00:01:10", ""})
+	service.processTimingEvent(timingRequest{"e058c321-b904-46ac-a7fb-9bf0ffeb518e", "finish_corridor", "00:01:12", ""})
+	assert.Equal(t, nil, client.ReadJSON(&status))
+	assert.Equal(t, 2, status.StartNumber)
+	assert.Equal(t, StatusInCorridor, status.Status)
+	assert.Equal(t, 2, status.Rank)
+}
@@ -0,0 +1,180 @@
+package athletes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/go-chi/chi"
+)
+
+// Wave is a group of athletes released together. GunTime is clock time of the wave
+// start signal, athletes of wave without gun time start at gun time of Race
+type Wave struct {
+	ID      string `json:"id" validate:"required,max=32"`
+	GunTime string `json:"gun_time,omitempty" validate:"omitempty,datetime=15:04:05.999"`
+}
+
+// WaveStatus is sent to all connected ws clients when Wave is started
+type WaveStatus struct {
+	Type string `json:"type"`
+	Wave Wave   `json:"wave"`
+}
+
+// waves guards waves of the Service, kept in order of definition
+type waves struct {
+	mu      sync.RWMutex
+	current []Wave
+}
+
+func newWaves() *waves {
+	return &waves{current: []Wave{}}
+}
+
+func (w *waves) all() []Wave {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return append([]Wave{}, w.current...)
+}
+
+func (w *waves) set(waves []Wave) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.current = append([]Wave{}, waves...)
+}
+
+// start sets gun time of wave with id. Returns WaveNotFound if wave is not defined
+func (w *waves) start(id, gunTime string) (Wave, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i := range w.current {
+		if w.current[i].ID == id {
+			w.current[i].GunTime = gunTime
+			return w.current[i], nil
+		}
+	}
+	return Wave{}, WaveNotFound{id}
+}
+
+// starts returns gun times by wave for Leaderboard.SetStarts, raceGunTime
+// is the start of athletes without wave and of waves without gun time
+func (w *waves) starts(raceGunTime string) map[string]string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	starts := map[string]string{}
+	if raceGunTime != "" {
+		starts[""] = raceGunTime
+	}
+	for _, wave := range w.current {
+		if wave.GunTime != "" {
+			starts[wave.ID] = wave.GunTime
+		}
+	}
+	return starts
+}
+
+// SetWaves defines waves of the event, gun times may be set later by StartWave.
+// Must be called before OpenJournal and JoinCluster as journal and other instances
+// start defined waves
+func (s Service) SetWaves(waves []Wave) error {
+	defined := map[string]bool{}
+	for _, wave := range waves {
+		if err := s.Validate(wave); err != nil {
+			return fmt.Errorf("wave %s: %w", wave.ID, err)
+		}
+		if defined[wave.ID] {
+			return fmt.Errorf("wave %s is defined twice", wave.ID)
+		}
+		defined[wave.ID] = true
+	}
+	s.waves.set(waves)
+	s.updateStarts()
+	return nil
+}
+
+// StartWave sets gun time of wave, gun time of already started wave is corrected.
+// Elapsed times of athletes of the wave are recalculated
+func (s Service) StartWave(id, gunTime string) (Wave, error) {
+	wave, err := s.waves.start(id, gunTime)
+	if err != nil {
+		return wave, err
+	}
+	s.logger.Infof("Wave %s: started at %s", wave.ID, wave.GunTime)
+	s.publish(replicatedEvent{Kind: replicatedWave, Wave: wave.ID, GunTime: wave.GunTime})
+	s.waveStarted(wave)
+	return wave, nil
+}
+
+// waveStarted notifies all connected ws clients about started wave and updates starts of leaderboard
+func (s Service) waveStarted(wave Wave) {
+	jsonData, err := json.Marshal(WaveStatus{"wave_start", wave})
+	if err != nil {
+		s.logger.Errorln(err.Error())
+		return
+	}
+	s.wsManager.SendMessageToAll(jsonData)
+	s.updateStarts()
+}
+
+// updateStarts passes gun times of waves and race to leaderboard. If elapsed times
+// or ranking changed, all connected ws clients receive the whole leaderboard
+func (s Service) updateStarts() {
+	if !s.leadeboard.SetStarts(s.waves.starts(s.race.get().GunTime)) {
+		return
+	}
+	jsonData, err := json.Marshal(s.leadeboard.CurrentState())
+	if err != nil {
+		s.logger.Errorln(err.Error())
+		return
+	}
+	s.wsManager.SendMessageToAll(jsonData)
+}
+
+// waveStartRequest is body of StartWaveHandler
+type waveStartRequest struct {
+	GunTime string `json:"gun_time" validate:"required,datetime=15:04:05.999"`
+}
+
+// WavesHandler responds with defined waves
+func (s Service) WavesHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jsonData, err := json.Marshal(s.waves.all())
+		if err != nil {
+			s.requestLogger(r).Errorln(err.Error())
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, jsonData, http.StatusOK)
+	}
+}
+
+// StartWaveHandler passes wave URL parameter and gun time of request body
+// to StartWave and responds with started Wave
+func (s Service) StartWaveHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		request := waveStartRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.Validate(request); err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		wave, err := s.StartWave(chi.URLParam(r, "wave"), request.GunTime)
+		if errors.As(err, &WaveNotFound{}) {
+			writeError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		jsonData, err := json.Marshal(wave)
+		if err != nil {
+			s.requestLogger(r).Errorln(err.Error())
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, jsonData, http.StatusOK)
+	}
+}
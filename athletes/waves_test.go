@@ -0,0 +1,154 @@
+package athletes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func newWavesService(t *testing.T) *Service {
+	store, err := NewMemoryStore(Athletes{
+		Athlete{"John", "Doe", "d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", 1, "A"},
+		Athlete{"Jonah", "Hubbard", "e058c321-b904-46ac-a7fb-9bf0ffeb518e", 2, "B"},
+		Athlete{"Felicia", "Perez", "32f637d8-40f9-454e-b7b5-88734865cba2", 3, ""},
+	})
+	assert.Equal(t, nil, err)
+	service, err := NewService(logrus.New(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.SetWaves([]Wave{{ID: "A", GunTime: "09:00:00"}, {ID: "B"}}); err != nil {
+		t.Fatal(err)
+	}
+	service.SetAutoStart(true)
+	return service
+}
+
+func TestWaves(t *testing.T) {
+	service := newWavesService(t)
+	assert.NotEqual(t, nil, service.SetWaves([]Wave{{ID: "A"}, {ID: "A"}}))
+	assert.NotEqual(t, nil, service.SetWaves([]Wave{{ID: "A", GunTime: "9am"}}))
+	assert.Equal(t, []Wave{{"A", "09:00:00"}, {"B", ""}}, service.waves.all())
+
+	startNumbers := func() []int {
+		numbers := []int{}
+		for _, row := range service.leadeboard.CurrentState() {
+			numbers = append(numbers, row.StartNumber)
+		}
+		return numbers
+	}
+	for _, read := range []timingRequest{
+		{"d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", "finish_line", "09:30:00", ""},
+		{"e058c321-b904-46ac-a7fb-9bf0ffeb518e", "finish_line", "09:33:00", ""},
+		{"32f637d8-40f9-454e-b7b5-88734865cba2", "finish_line", "09:29:00", ""},
+	} {
+		_, err := service.processTimingEvent(read)
+		assert.Equal(t, nil, err)
+	}
+	// Only wave A has gun time, race was started by the first timing event
+	rows := service.leadeboard.CurrentState()
+	assert.Equal(t, []int{1, 3, 2}, startNumbers())
+	assert.Equal(t, "00:30:00", rows[0].Elapsed)
+	assert.Equal(t, "", rows[1].Elapsed)
+
+	// Wave B started later ranks by time since its own start
+	wave, err := service.StartWave("B", "09:05:00")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, Wave{"B", "09:05:00"}, wave)
+	rows = service.leadeboard.CurrentState()
+	assert.Equal(t, []int{2, 1, 3}, startNumbers())
+	assert.Equal(t, "00:28:00", rows[0].Elapsed)
+
+	// Gun time of wave is corrected
+	_, err = service.StartWave("B", "09:02:00")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []int{1, 2, 3}, startNumbers())
+	assert.Equal(t, "00:31:00", service.leadeboard.CurrentState()[1].Elapsed)
+
+	_, err = service.StartWave("C", "09:10:00")
+	assert.Equal(t, WaveNotFound{"C"}, err)
+
+	page, _, _, _ := leaderboardQuery{Wave: "B"}.apply(service.leadeboard.CurrentState())
+	assert.Equal(t, 1, len(page))
+	assert.Equal(t, "Jonah", page[0].FirstName)
+}
+
+func TestWaveStartsOfRace(t *testing.T) {
+	service := newWavesService(t)
+	_, err := service.TransitionRace("start", "08:55:00")
+	assert.Equal(t, nil, err)
+	_, err = service.processTimingEvent(timingRequest{"32f637d8-40f9-454e-b7b5-88734865cba2", "finish_line", "09:29:00", ""})
+	assert.Equal(t, nil, err)
+	_, err = service.processTimingEvent(timingRequest{"e058c321-b904-46ac-a7fb-9bf0ffeb518e", "finish_line", "09:30:00", ""})
+	assert.Equal(t, nil, err)
+
+	// Athletes without wave and of waves without gun time start with race
+	rows := service.leadeboard.CurrentState()
+	assert.Equal(t, "00:34:00", rows[0].Elapsed)
+	assert.Equal(t, "00:35:00", rows[1].Elapsed)
+}
+
+func TestWaveReplication(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "event.journal")
+	buses := newMemoryBuses(2)
+	a, b := newWavesService(t), newWavesService(t)
+	if err := a.OpenJournal(path); err != nil {
+		t.Fatal(err)
+	}
+	a.JoinCluster(buses[0])
+	b.JoinCluster(buses[1])
+
+	// Wave started by a is started by b
+	_, err := a.StartWave("B", "09:05:00")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []Wave{{"A", "09:00:00"}, {"B", "09:05:00"}}, b.waves.all())
+	_, err = b.processTimingEvent(timingRequest{"e058c321-b904-46ac-a7fb-9bf0ffeb518e", "finish_line", "09:33:00", ""})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "00:28:00", a.leadeboard.CurrentState()[0].Elapsed)
+	a.Close()
+
+	// Gun times of waves are recovered from journal after restart
+	a = newWavesService(t)
+	if err := a.OpenJournal(path); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []Wave{{"A", "09:00:00"}, {"B", "09:05:00"}}, a.waves.all())
+	assert.Equal(t, "00:28:00", a.leadeboard.CurrentState()[0].Elapsed)
+	a.Close()
+}
+
+func TestWaveHandlers(t *testing.T) {
+	service := newWavesService(t)
+	r := chi.NewRouter()
+	r.Get("/waves", service.WavesHandler())
+	r.Post("/admin/waves/{wave}/start", service.StartWaveHandler())
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", path, strings.NewReader(body)))
+		return w
+	}
+	assert.Equal(t, http.StatusBadRequest, post("/admin/waves/B/start", "").Code)
+	assert.Equal(t, http.StatusBadRequest, post("/admin/waves/B/start", `{"gun_time":"9am"}`).Code)
+	assert.Equal(t, http.StatusNotFound, post("/admin/waves/C/start", `{"gun_time":"09:05:00"}`).Code)
+
+	w := post("/admin/waves/B/start", `{"gun_time":"09:05:00"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var wave Wave
+	assert.Equal(t, nil, json.Unmarshal(w.Body.Bytes(), &wave))
+	assert.Equal(t, Wave{"B", "09:05:00"}, wave)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/waves", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var waves []Wave
+	assert.Equal(t, nil, json.Unmarshal(w.Body.Bytes(), &waves))
+	assert.Equal(t, []Wave{{"A", "09:00:00"}, {"B", "09:05:00"}}, waves)
+}
@@ -0,0 +1,148 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ReloadInterval is the interval of checking whether certificate files were rotated
+const ReloadInterval = 10 * time.Second
+
+// Reloader keeps TLS certificate loaded from certFile and keyFile and reloads it
+// when the files are modified, so rotated certificates are used without restart
+type Reloader struct {
+	certFile string
+	keyFile  string
+	logger   *logrus.Logger
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewReloader loads certificate from certFile and keyFile and returns Reloader
+func NewReloader(certFile, keyFile string, logger *logrus.Logger) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile, logger: logger}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns current certificate, used as tls.Config.GetCertificate
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Watch checks certificate files every interval and reloads certificate if they were
+// modified until ctx is done. Certificate which can not be loaded is logged and the
+// previous one is kept, e.g. while only one of the files is replaced
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			reloaded, err := r.reload()
+			if err != nil {
+				r.logger.Errorln("TLS certificate reload:", err)
+				continue
+			}
+			if reloaded {
+				r.logger.Infoln("TLS certificate reloaded from", r.certFile)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reload loads certificate if certificate or key file was modified since the last load
+// and reports whether certificate was replaced
+func (r *Reloader) reload() (bool, error) {
+	modTime, err := latestModTime(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+	r.mu.RLock()
+	unchanged := r.cert != nil && modTime.Equal(r.modTime)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("loading certificate: %w", err)
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.mu.Unlock()
+	return true, nil
+}
+
+func latestModTime(paths ...string) (time.Time, error) {
+	latest := time.Time{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// ServerConfig returns tls.Config serving certificate of reloader over HTTP/2 or HTTP/1.1.
+// If clientCAFile is set, client certificates are requested and verified against its
+// CA certificates, but connections without certificate are still accepted, see RequireClientCert
+func ServerConfig(reloader *Reloader, clientCAFile string) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+	if clientCAFile == "" {
+		return config, nil
+	}
+	pem, err := ioutil.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", clientCAFile)
+	}
+	config.ClientCAs = pool
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	return config, nil
+}
+
+// RequireClientCert responds with 401 status to requests without verified client certificate.
+// Used for endpoints of timing devices when mutual TLS is required
+func RequireClientCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			jsonData, _ := json.Marshal(map[string]string{"error": "client certificate required"})
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write(jsonData)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,163 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// issue creates certificate with commonName signed by parent, self-signed if parent is nil
+func issue(t *testing.T, commonName string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, tls.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Equal(t, nil, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	assert.Equal(t, nil, err)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	assert.Equal(t, nil, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Equal(t, nil, err)
+	return cert, key, tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// writePEM writes certificate and key of pair to certFile and keyFile
+func writePEM(t *testing.T, pair tls.Certificate, certFile, keyFile string) {
+	keyDER, err := x509.MarshalECPrivateKey(pair.PrivateKey.(*ecdsa.PrivateKey))
+	assert.Equal(t, nil, err)
+	err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: pair.Certificate[0]}), 0600)
+	assert.Equal(t, nil, err)
+	err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	assert.Equal(t, nil, err)
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	_, _, first := issue(t, "first", nil, nil)
+	writePEM(t, first, certFile, keyFile)
+
+	reloader, err := NewReloader(certFile, keyFile, logrus.New())
+	assert.Equal(t, nil, err)
+	cert, err := reloader.GetCertificate(nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, first.Certificate, cert.Certificate)
+
+	// Files are not modified
+	reloaded, err := reloader.reload()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, reloaded)
+
+	// Rotated certificate
+	_, _, second := issue(t, "second", nil, nil)
+	writePEM(t, second, certFile, keyFile)
+	future := time.Now().Add(time.Minute)
+	assert.Equal(t, nil, os.Chtimes(certFile, future, future))
+	reloaded, err = reloader.reload()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, reloaded)
+	cert, _ = reloader.GetCertificate(nil)
+	assert.Equal(t, second.Certificate, cert.Certificate)
+
+	// Broken key keeps previous certificate
+	assert.Equal(t, nil, ioutil.WriteFile(keyFile, []byte("broken"), 0600))
+	future = future.Add(time.Minute)
+	assert.Equal(t, nil, os.Chtimes(keyFile, future, future))
+	_, err = reloader.reload()
+	assert.NotEqual(t, nil, err)
+	cert, _ = reloader.GetCertificate(nil)
+	assert.Equal(t, second.Certificate, cert.Certificate)
+
+	_, err = NewReloader(filepath.Join(dir, "missing.crt"), keyFile, logrus.New())
+	assert.NotEqual(t, nil, err)
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey, caPair := issue(t, "timing CA", nil, nil)
+	_, _, serverPair := issue(t, "server", ca, caKey)
+	_, _, devicePair := issue(t, "device", ca, caKey)
+	_, _, strangerPair := issue(t, "stranger", nil, nil)
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	writePEM(t, serverPair, certFile, keyFile)
+	caFile := filepath.Join(dir, "ca.crt")
+	writePEM(t, caPair, caFile, filepath.Join(dir, "ca.key"))
+
+	reloader, err := NewReloader(certFile, keyFile, logrus.New())
+	assert.Equal(t, nil, err)
+	config, err := ServerConfig(reloader, caFile)
+	assert.Equal(t, nil, err)
+
+	mux := http.NewServeMux()
+	mux.Handle("/update", RequireClientCert(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	mux.HandleFunc("/leaderboard", func(w http.ResponseWriter, r *http.Request) {})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, nil, err)
+	server := &http.Server{Handler: mux, TLSConfig: config, ErrorLog: log.New(ioutil.Discard, "", 0)}
+	go server.ServeTLS(listener, "", "")
+	defer server.Close()
+	url := "https://" + listener.Addr().String()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	client := func(certificates ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: roots, Certificates: certificates},
+			ForceAttemptHTTP2: true,
+		}}
+	}
+
+	// Public endpoints are served over HTTP/2 without client certificate
+	resp, err := client().Get(url + "/leaderboard")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2, resp.ProtoMajor)
+	resp.Body.Close()
+
+	resp, err = client().Post(url+"/update", "application/json", nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp.Body.Close()
+
+	resp, err = client(devicePair).Post(url+"/update", "application/json", nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	// Certificate of unknown CA is not accepted
+	resp, err = client(strangerPair).Post(url+"/update", "application/json", nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp.Body.Close()
+
+	_, err = ServerConfig(reloader, filepath.Join(dir, "ca.key"))
+	assert.NotEqual(t, nil, err)
+}
@@ -0,0 +1,241 @@
+package cluster
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/stdlib"
+	"github.com/sirupsen/logrus"
+)
+
+// Channel is the Postgres notification channel used by server instances
+const Channel = "event_timing"
+
+// reconnectDelay is the time to wait before listening again after connection was lost
+const reconnectDelay = time.Second
+
+// Handler processes message published by another instance
+type Handler func([]byte)
+
+// Bus interface
+//
+// Publish sends message to all other instances listening on the same channel.
+//
+// Subscribe sets handler which is called with every message published by other instances,
+// messages are handled one by one in order they were published
+//
+// OnReconnect sets function called once lost listening connection is reopened.
+// Messages published while connection was lost are not received
+//
+// Close stops listening and closes db connections
+type Bus interface {
+	Publish([]byte) error
+	Subscribe(Handler)
+	OnReconnect(func())
+	Close()
+}
+
+// envelope wraps published message with ID of instance which published it,
+// so that instance can skip its own messages
+type envelope struct {
+	Origin  string          `json:"origin"`
+	Message json.RawMessage `json:"message"`
+}
+
+// listener is a connection subscribed to channel notifications
+type listener interface {
+	WaitForNotification(context.Context) (string, error)
+	Close()
+}
+
+// notifier sends notifications, implemented by *sql.DB
+type notifier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Close() error
+}
+
+// pgBus implements Bus using Postgres LISTEN/NOTIFY. Notifications are sent
+// through db pool, listening holds a dedicated connection opened by listen.
+// Messages published while listening connection is lost are not received
+type pgBus struct {
+	instanceID  string
+	channel     string
+	db          notifier
+	listen      func(context.Context) (listener, error)
+	logger      *logrus.Logger
+	cancel      context.CancelFunc
+	mu          sync.Mutex
+	handler     Handler
+	reconnected func()
+	done        chan struct{}
+}
+
+// NewPostgresBus connects to db and starts listening on channel. Returned Bus
+// receives messages once Subscribe is called
+func NewPostgresBus(connectionString, channel string, logger *logrus.Logger) (Bus, error) {
+	c, err := pgx.ParseConfig(connectionString)
+	if err != nil {
+		return nil, fmt.Errorf("parsing postgres URI: %w", err)
+	}
+	listen := func(ctx context.Context) (listener, error) {
+		return listenPostgres(ctx, connectionString, channel)
+	}
+	db := stdlib.OpenDB(*c)
+	b, err := newBus(db, listen, channel, logger)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// newBus opens listening connection and starts receiving notifications
+func newBus(db notifier, listen func(context.Context) (listener, error), channel string, logger *logrus.Logger) (*pgBus, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	conn, err := listen(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	b := &pgBus{
+		instanceID: uuid.New().String(),
+		channel:    channel,
+		db:         db,
+		listen:     listen,
+		logger:     logger,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+	go b.receive(ctx, conn)
+	return b, nil
+}
+
+// pgListener implements listener with pgx connection
+type pgListener struct {
+	conn *pgx.Conn
+}
+
+func (l pgListener) WaitForNotification(ctx context.Context) (string, error) {
+	n, err := l.conn.WaitForNotification(ctx)
+	if err != nil {
+		return "", err
+	}
+	return n.Payload, nil
+}
+
+func (l pgListener) Close() {
+	l.conn.Close(context.Background())
+}
+
+// listenPostgres opens connection and subscribes it to channel notifications
+func listenPostgres(ctx context.Context, connectionString, channel string) (listener, error) {
+	conn, err := pgx.Connect(ctx, connectionString)
+	if err != nil {
+		return nil, fmt.Errorf("listen connection: %w", err)
+	}
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		conn.Close(context.Background())
+		return nil, fmt.Errorf("listen %s: %w", channel, err)
+	}
+	return pgListener{conn}, nil
+}
+
+const notifyQuery = `
+SELECT pg_notify($1, $2)
+`
+
+func (b *pgBus) Publish(msg []byte) error {
+	payload, err := json.Marshal(envelope{b.instanceID, msg})
+	if err != nil {
+		return err
+	}
+	_, err = b.db.Exec(notifyQuery, b.channel, string(payload))
+	return err
+}
+
+func (b *pgBus) Subscribe(handler Handler) {
+	b.mu.Lock()
+	b.handler = handler
+	b.mu.Unlock()
+}
+
+func (b *pgBus) OnReconnect(reconnected func()) {
+	b.mu.Lock()
+	b.reconnected = reconnected
+	b.mu.Unlock()
+}
+
+func (b *pgBus) Close() {
+	b.cancel()
+	<-b.done
+	b.db.Close()
+}
+
+// receive waits for notifications and passes messages of other instances to handler
+// until ctx is canceled. Listening connection is reopened if it was lost, then
+// function set by OnReconnect is called
+func (b *pgBus) receive(ctx context.Context, conn listener) {
+	defer close(b.done)
+	for {
+		payload, err := conn.WaitForNotification(ctx)
+		if ctx.Err() != nil {
+			conn.Close()
+			return
+		}
+		if err != nil {
+			b.logger.Errorf("Cluster: %v, reconnecting", err)
+			conn.Close()
+			if conn = b.reconnect(ctx); conn == nil {
+				return
+			}
+			b.mu.Lock()
+			reconnected := b.reconnected
+			b.mu.Unlock()
+			if reconnected != nil {
+				reconnected()
+			}
+			continue
+		}
+		b.handle([]byte(payload))
+	}
+}
+
+// reconnect opens listening connection until it succeeds, returns nil if ctx was canceled
+func (b *pgBus) reconnect(ctx context.Context) listener {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(reconnectDelay):
+		}
+		conn, err := b.listen(ctx)
+		if err == nil {
+			b.logger.Infoln("Cluster: listening on", b.channel)
+			return conn
+		}
+		b.logger.Errorf("Cluster: %v", err)
+	}
+}
+
+func (b *pgBus) handle(payload []byte) {
+	e := envelope{}
+	if err := json.Unmarshal(payload, &e); err != nil {
+		b.logger.Errorf("Cluster: invalid message: %v", err)
+		return
+	}
+	if e.Origin == b.instanceID {
+		return
+	}
+	b.mu.Lock()
+	handler := b.handler
+	b.mu.Unlock()
+	if handler != nil {
+		handler(e.Message)
+	}
+}
@@ -0,0 +1,130 @@
+package cluster
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// hub delivers notifications sent through it as notifier to all open listeners
+type hub struct {
+	mu        sync.Mutex
+	listeners []*hubListener
+}
+
+type hubListener struct {
+	notifications chan string
+	lost          chan error
+}
+
+func (h *hub) Exec(query string, args ...interface{}) (sql.Result, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, l := range h.listeners {
+		l.notifications <- args[1].(string)
+	}
+	return nil, nil
+}
+
+func (h *hub) Close() error { return nil }
+
+func (h *hub) listen(ctx context.Context) (listener, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	l := &hubListener{make(chan string, 16), make(chan error, 1)}
+	h.listeners = append(h.listeners, l)
+	return l, nil
+}
+
+// lose drops listener i as if its connection was lost
+func (h *hub) lose(i int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listeners[i].lost <- errors.New("connection lost")
+	h.listeners = append(h.listeners[:i], h.listeners[i+1:]...)
+}
+
+func (l *hubListener) WaitForNotification(ctx context.Context) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case err := <-l.lost:
+		return "", err
+	case payload := <-l.notifications:
+		return payload, nil
+	}
+}
+
+func (l *hubListener) Close() {}
+
+func newTestBuses(t *testing.T, h *hub) (*pgBus, *pgBus) {
+	a, err := newBus(h, h.listen, Channel, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := newBus(h, h.listen, Channel, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, b
+}
+
+// receive returns the next message from messages, fails test if none arrives
+func receive(t *testing.T, messages chan []byte) string {
+	select {
+	case msg := <-messages:
+		return string(msg)
+	case <-time.After(time.Second):
+		t.Fatal("message not received")
+		return ""
+	}
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	a, b := newTestBuses(t, &hub{})
+	defer a.Close()
+	defer b.Close()
+	aMessages, bMessages := make(chan []byte, 4), make(chan []byte, 4)
+	a.Subscribe(func(msg []byte) { aMessages <- msg })
+	b.Subscribe(func(msg []byte) { bMessages <- msg })
+
+	// Messages are received by other instances in order, not by the publisher
+	assert.Equal(t, nil, a.Publish([]byte(`{"kind":"timing"}`)))
+	assert.Equal(t, nil, a.Publish([]byte(`{"kind":"race"}`)))
+	assert.Equal(t, `{"kind":"timing"}`, receive(t, bMessages))
+	assert.Equal(t, `{"kind":"race"}`, receive(t, bMessages))
+	assert.Equal(t, nil, b.Publish([]byte(`{"kind":"wave"}`)))
+	assert.Equal(t, `{"kind":"wave"}`, receive(t, aMessages))
+
+	// Invalid notifications are skipped
+	a.handle([]byte("not json"))
+	assert.Equal(t, 0, len(aMessages))
+}
+
+func TestReconnect(t *testing.T) {
+	h := &hub{}
+	a, b := newTestBuses(t, h)
+	defer a.Close()
+	defer b.Close()
+	bMessages := make(chan []byte, 4)
+	reconnected := make(chan struct{}, 1)
+	b.Subscribe(func(msg []byte) { bMessages <- msg })
+	b.OnReconnect(func() { reconnected <- struct{}{} })
+
+	// Messages published while connection is lost are not received
+	h.lose(1)
+	assert.Equal(t, nil, a.Publish([]byte(`{"kind":"timing"}`)))
+	select {
+	case <-reconnected:
+	case <-time.After(reconnectDelay + time.Second):
+		t.Fatal("not reconnected")
+	}
+	assert.Equal(t, nil, a.Publish([]byte(`{"kind":"race"}`)))
+	assert.Equal(t, `{"kind":"race"}`, receive(t, bMessages))
+}
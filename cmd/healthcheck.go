@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"gitlab.com/mooncascade/event-timing-server/config"
+)
+
+// healthcheck requests readiness endpoint of a running server and returns an error
+// if server is not ready. Used by Docker HEALTHCHECK as the image has no shell or curl.
+// Unless -url is given, URL is derived from config file and EVENT_TIMING_* environment
+// variables the server is started with, see readyzURL
+func healthcheck(args []string) error {
+	flags := flag.NewFlagSet("healthcheck", flag.ExitOnError)
+	configFile := flags.String(configFlag, os.Getenv(config.EnvPrefix+"CONFIG"), "YAML config file of the server")
+	url := flags.String("url", "", "Health endpoint URL, derived from listen address and TLS settings of server config if empty")
+	timeout := flags.Duration("timeout", 3*time.Second, "Request timeout")
+	insecure := flags.Bool("insecure", false, "Skip verification of server certificate, e.g. for https://localhost. Set for derived https URL")
+	flags.Parse(args)
+
+	if *url == "" {
+		cfg, err := config.Load(*configFile)
+		if err != nil {
+			return err
+		}
+		*url = readyzURL(cfg)
+		// Certificate of the server is not issued for localhost
+		*insecure = *insecure || cfg.TLS.Enabled()
+	}
+	client := http.Client{Timeout: *timeout}
+	if *insecure {
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	resp, err := client.Get(*url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("not healthy: %s: %s", resp.Status, body)
+	}
+	return nil
+}
+
+// readyzURL returns URL of readiness endpoint of server started with cfg on the same host,
+// https if TLS is enabled. Wildcard listen address is reached through localhost
+func readyzURL(cfg config.Config) string {
+	scheme := "http"
+	if cfg.TLS.Enabled() {
+		scheme = "https"
+	}
+	host, port, err := net.SplitHostPort(cfg.Listen)
+	if err != nil {
+		return fmt.Sprintf("%s://%s/readyz", scheme, cfg.Listen)
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+	return fmt.Sprintf("%s://%s/readyz", scheme, net.JoinHostPort(host, port))
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"gitlab.com/mooncascade/event-timing-server/config"
+	"gitlab.com/mooncascade/event-timing-server/lineprotocol"
+)
+
+// replay posts timing log file to /admin/replay endpoint of a running server
+// and prints reconciliation report to stdout
+func replay(args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	server := flags.String("server", "http://localhost:8080", "Event timing server URL")
+	format := flags.String("format", strings.Join(lineprotocol.DefaultFormat.Fields, ","), "Comma separated fields of a line, use - to skip a field")
+	delimiter := flags.String("delimiter", lineprotocol.DefaultFormat.Delimiter, "Field delimiter of a line, empty means any whitespace")
+	points := flags.String("points", "", "Timing point names mapping, e.g. FC=finish_corridor,FL=finish_line")
+	cert := flags.String("cert", "", "Client certificate file, required if server requires client certificates")
+	key := flags.String("key", "", "Private key file of client certificate")
+	insecure := flags.Bool("insecure", false, "Skip verification of server certificate, e.g. for https://localhost")
+	token := flags.String("token", os.Getenv(config.EnvPrefix+"ADMIN_TOKEN"), "Admin token of server, defaults to "+config.EnvPrefix+"ADMIN_TOKEN env variable")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: event-timing-server replay [flags] <file>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("timing log file is required")
+	}
+	if _, err := lineprotocol.ParseFormat(*format, *delimiter, *points); err != nil {
+		return err
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: *insecure}
+	if *cert != "" {
+		certificate, err := tls.LoadX509KeyPair(*cert, *key)
+		if err != nil {
+			return err
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	client := http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+
+	query := url.Values{}
+	query.Set("format", *format)
+	query.Set("delimiter", *delimiter)
+	query.Set("points", *points)
+	req, err := http.NewRequest("POST", strings.TrimSuffix(*server, "/")+"/admin/replay?"+query.Encode(), file)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	if *token != "" {
+		req.Header.Set("Authorization", "Bearer "+*token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("replay failed: %s: %s", resp.Status, body)
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, body, "", "  "); err != nil {
+		return err
+	}
+	out.WriteString("\n")
+	_, err = out.WriteTo(os.Stdout)
+	return err
+}
@@ -0,0 +1,168 @@
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	c, err := Load("")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, c.Validate())
+	assert.Equal(t, ":8080", c.Listen)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err = ioutil.WriteFile(path, []byte(`
+listen: ":9090"
+database:
+  url: sqlite://event.db
+  max_open_conns: 10
+websocket:
+  max_clients: 100
+  allowed_origins: [https://results.example.com]
+log:
+  level: debug
+  format: json
+  components:
+    websocket: warn
+  websocket_sampling: 100
+event:
+  min_gap: 2s
+  max_gap: 1m
+  waves:
+    - id: A
+      gun_time: "09:00:00"
+    - id: B
+  lap_race: true
+  laps: 10
+  min_lap_time: 30s
+timing_points:
+  - id: finish_corridor
+    aliases: [FC]
+  - id: finish_line
+    aliases: [FL]
+`), 0644)
+	assert.Equal(t, nil, err)
+	c, err = Load(path)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, c.Validate())
+	assert.Equal(t, ":9090", c.Listen)
+	assert.Equal(t, Database{"sqlite://event.db", 10, 0}, c.Database)
+	assert.Equal(t, WebSocket{100, []string{"https://results.example.com"}}, c.WebSocket)
+	assert.Equal(t, Log{"debug", "json", map[string]string{"websocket": "warn"}, 100}, c.Log)
+	assert.Equal(t, 2*time.Second, c.Event.MinGap)
+	assert.Equal(t, time.Minute, c.Event.MaxGap)
+	assert.Equal(t, []Wave{{"A", "09:00:00"}, {"B", ""}}, c.Event.Waves)
+	assert.Equal(t, true, c.Event.LapRace)
+	assert.Equal(t, 10, c.Event.Laps)
+	assert.Equal(t, 30*time.Second, c.Event.MinLapTime)
+	// Defaults are kept for missing keys
+	assert.Equal(t, true, c.Event.RequireCorridor)
+	assert.Equal(t, 12.5, c.Event.MaxSpeed)
+	assert.Equal(t, "FC=finish_corridor,FL=finish_line", c.PointsMapping())
+
+	// Unknown key
+	err = ioutil.WriteFile(path, []byte("listen: \":9090\"\nlisten_port: 9090\n"), 0644)
+	assert.Equal(t, nil, err)
+	_, err = Load(path)
+	assert.NotEqual(t, nil, err)
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.NotEqual(t, nil, err)
+}
+
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"DBURL":                                  "postgres://db/event",
+		"EVENT_TIMING_LISTEN":                    ":9090",
+		"EVENT_TIMING_WEBSOCKET_ALLOWED_ORIGINS": "https://a.example.com, https://b.example.com",
+		"EVENT_TIMING_EVENT_CHECK_ORDER":         "false",
+		"EVENT_TIMING_EVENT_DEVICE_TIMEOUT":      "1m",
+		"EVENT_TIMING_TIMING_POINTS":             "FC=finish_corridor,FL=finish_line",
+		"EVENT_TIMING_CLUSTER":                   "true",
+		"EVENT_TIMING_LOG_COMPONENTS":            "websocket=warn, cluster=debug",
+		"EVENT_TIMING_EVENT_WAVES":               "A=09:00:00, B",
+		"EVENT_TIMING_EVENT_LAP_RACE":            "true",
+		"EVENT_TIMING_EVENT_LAPS":                "5",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	c := Default()
+	assert.Equal(t, nil, c.ApplyEnv(lookup))
+	assert.Equal(t, nil, c.Validate())
+	assert.Equal(t, "postgres://db/event", c.Database.URL)
+	assert.Equal(t, ":9090", c.Listen)
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com"}, c.WebSocket.AllowedOrigins)
+	assert.Equal(t, false, c.Event.CheckOrder)
+	assert.Equal(t, time.Minute, c.Event.DeviceTimeout)
+	assert.Equal(t, "FC=finish_corridor,FL=finish_line", c.PointsMapping())
+	assert.Equal(t, true, c.Cluster)
+	assert.Equal(t, map[string]string{"websocket": "warn", "cluster": "debug"}, c.Log.Components)
+	assert.Equal(t, []Wave{{"A", "09:00:00"}, {"B", ""}}, c.Event.Waves)
+	assert.Equal(t, true, c.Event.LapRace)
+	assert.Equal(t, 5, c.Event.Laps)
+
+	env = map[string]string{
+		"EVENT_TIMING_DATABASE_MAX_OPEN_CONNS": "ten",
+		"EVENT_TIMING_SHUTDOWN_TIMEOUT":        "5",
+	}
+	c = Default()
+	err := c.ApplyEnv(lookup)
+	invalid := InvalidConfig{}
+	assert.Equal(t, true, errors.As(err, &invalid))
+	assert.Equal(t, 2, len(invalid.Problems))
+}
+
+func TestValidate(t *testing.T) {
+	c := Default()
+	c.TLS.Cert = "server.crt"
+	c.TLS.RequireDeviceCert = true
+	c.Log.Level = "verbose"
+	c.Log.Format = "xml"
+	c.Log.Components = map[string]string{"websocket": "loud", "router": "info"}
+	c.Event.MinGap = time.Minute
+	c.Event.MaxGap = time.Second
+	c.Event.Waves = []Wave{{ID: "A", GunTime: "9am"}, {ID: "A"}}
+	c.Event.Laps = -1
+	c.WebSocket.MaxClients = -1
+	c.LineProtocol.Listen = ":9000"
+	c.LineProtocol.Format = "chip_id,clock_time"
+	c.TimingPoints = []TimingPoint{
+		{ID: "finish_corridor", Aliases: []string{"F"}},
+		{ID: "finish_line", Aliases: []string{"F"}},
+		{ID: "start_line"},
+	}
+	c.Cluster = true
+	c.Database.URL = "memory://"
+
+	err := c.Validate()
+	invalid := InvalidConfig{}
+	assert.Equal(t, true, errors.As(err, &invalid))
+	assert.Equal(t, []string{
+		"tls: cert and key must be set together",
+		"tls.cert: stat server.crt: no such file or directory",
+		"tls.require_device_cert: requires tls.client_ca",
+		"websocket.max_clients: must not be negative",
+		`log.level: unknown level "verbose"`,
+		`log.format: must be text or json, got "xml"`,
+		`log.components: unknown component "router", known are http, athletes, websocket, lineprotocol, cluster`,
+		`log.components: unknown level "loud" of websocket`,
+		"event.max_gap: must not be less than event.min_gap",
+		`event.waves: invalid gun_time "9am" of wave A, expected 15:04:05.999`,
+		`event.waves: wave "A" is defined twice`,
+		"event.laps: must not be negative",
+		"event.laps, event.min_lap_time: require event.lap_race",
+		invalid.Problems[13],
+		`timing_points: alias "F" is used by finish_corridor and finish_line`,
+		`timing_points: unknown timing point "start_line", known are finish_corridor, finish_line`,
+		"cluster: requires postgres database",
+	}, invalid.Problems)
+	assert.Contains(t, invalid.Problems[13], "line_protocol: ")
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix is the prefix of environment variables overriding config values
+const EnvPrefix = "EVENT_TIMING_"
+
+// LookupEnv returns value of environment variable and reports whether it is set, see os.LookupEnv
+type LookupEnv func(string) (string, bool)
+
+// ApplyEnv overrides config values by environment variables found by lookup.
+// Variable names are EnvPrefix followed by upper-cased YAML keys joined with underscore,
+// e.g. EVENT_TIMING_LOG_LEVEL. DBURL is accepted as EVENT_TIMING_DATABASE_URL.
+// Lists are comma separated, timing points are in "alias=timing_point_id" form,
+// waves are in "id=gun_time" form and log components are in "component=level" form
+func (c *Config) ApplyEnv(lookup LookupEnv) error {
+	problems := []string{}
+	env := func(name string, apply func(string) error) {
+		value, ok := lookup(EnvPrefix + name)
+		if !ok {
+			return
+		}
+		if err := apply(value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s%s: %v", EnvPrefix, name, err))
+		}
+	}
+
+	if value, ok := lookup("DBURL"); ok && value != "" {
+		c.Database.URL = value
+	}
+	env("LISTEN", setString(&c.Listen))
+	env("TLS_CERT", setString(&c.TLS.Cert))
+	env("TLS_KEY", setString(&c.TLS.Key))
+	env("TLS_CLIENT_CA", setString(&c.TLS.ClientCA))
+	env("TLS_REQUIRE_DEVICE_CERT", setBool(&c.TLS.RequireDeviceCert))
+	env("ADMIN_TOKEN", setString(&c.AdminToken))
+	env("DATABASE_URL", setString(&c.Database.URL))
+	env("DATABASE_MAX_OPEN_CONNS", setInt(&c.Database.MaxOpenConns))
+	env("DATABASE_MAX_IDLE_CONNS", setInt(&c.Database.MaxIdleConns))
+	env("WEBSOCKET_MAX_CLIENTS", setInt(&c.WebSocket.MaxClients))
+	env("WEBSOCKET_ALLOWED_ORIGINS", setList(&c.WebSocket.AllowedOrigins))
+	env("LOG_LEVEL", setString(&c.Log.Level))
+	env("LOG_FORMAT", setString(&c.Log.Format))
+	env("LOG_COMPONENTS", c.Log.ParseComponents)
+	env("LOG_WEBSOCKET_SAMPLING", setInt(&c.Log.WebSocketSampling))
+	env("EVENT_REQUIRE_CORRIDOR", setBool(&c.Event.RequireCorridor))
+	env("EVENT_CHECK_ORDER", setBool(&c.Event.CheckOrder))
+	env("EVENT_AUTO_START", setBool(&c.Event.AutoStart))
+	env("EVENT_MIN_GAP", setDuration(&c.Event.MinGap))
+	env("EVENT_MAX_GAP", setDuration(&c.Event.MaxGap))
+	env("EVENT_CORRIDOR_LENGTH", setFloat(&c.Event.CorridorLength))
+	env("EVENT_MAX_SPEED", setFloat(&c.Event.MaxSpeed))
+	env("EVENT_DEVICE_TIMEOUT", setDuration(&c.Event.DeviceTimeout))
+	env("EVENT_ROSTER", setString(&c.Event.Roster))
+	env("EVENT_JOURNAL", setString(&c.Event.Journal))
+	env("EVENT_WAVES", c.Event.ParseWaves)
+	env("EVENT_LAP_RACE", setBool(&c.Event.LapRace))
+	env("EVENT_LAPS", setInt(&c.Event.Laps))
+	env("EVENT_MIN_LAP_TIME", setDuration(&c.Event.MinLapTime))
+	env("LINE_PROTOCOL_LISTEN", setString(&c.LineProtocol.Listen))
+	env("LINE_PROTOCOL_FORMAT", setString(&c.LineProtocol.Format))
+	env("LINE_PROTOCOL_DELIMITER", setString(&c.LineProtocol.Delimiter))
+	env("TIMING_POINTS", c.ParseTimingPoints)
+	env("CLUSTER", setBool(&c.Cluster))
+	env("SHUTDOWN_TIMEOUT", setDuration(&c.ShutdownTimeout))
+
+	if len(problems) > 0 {
+		return InvalidConfig{problems}
+	}
+	return nil
+}
+
+func setString(dst *string) func(string) error {
+	return func(value string) error {
+		*dst = value
+		return nil
+	}
+}
+
+func setInt(dst *int) func(string) error {
+	return func(value string) (err error) {
+		*dst, err = strconv.Atoi(value)
+		return err
+	}
+}
+
+func setFloat(dst *float64) func(string) error {
+	return func(value string) (err error) {
+		*dst, err = strconv.ParseFloat(value, 64)
+		return err
+	}
+}
+
+func setBool(dst *bool) func(string) error {
+	return func(value string) (err error) {
+		*dst, err = strconv.ParseBool(value)
+		return err
+	}
+}
+
+func setDuration(dst *time.Duration) func(string) error {
+	return func(value string) (err error) {
+		*dst, err = time.ParseDuration(value)
+		return err
+	}
+}
+
+func setList(dst *[]string) func(string) error {
+	return func(value string) error {
+		*dst = []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*dst = append(*dst, item)
+			}
+		}
+		return nil
+	}
+}
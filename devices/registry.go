@@ -0,0 +1,175 @@
+package devices
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Device statuses
+const (
+	StatusOnline = "online"
+	StatusSilent = "silent"
+)
+
+// Device represents a timing device, e.g. a mat at the finish corridor.
+// Monitored devices sent a heartbeat and are checked for silence, devices which
+// only send reads, e.g. decoders over line protocol, are silent between athletes
+type Device struct {
+	ID            string    `json:"device_id"`
+	TimingPointID string    `json:"timing_point_id"`
+	Status        string    `json:"status"`
+	RegisteredAt  time.Time `json:"registered_at"`
+	LastSeen      time.Time `json:"last_seen"`
+	Reads         int       `json:"reads"`
+	ClockOffsetMS int64     `json:"clock_offset_ms"`
+	Monitored     bool      `json:"monitored"`
+}
+
+// ClockOffset returns measured difference between server and device clocks
+func (d Device) ClockOffset() time.Duration {
+	return time.Duration(d.ClockOffsetMS) * time.Millisecond
+}
+
+// DeviceNotFound .
+type DeviceNotFound struct {
+	DeviceID string
+}
+
+func (d DeviceNotFound) Error() string {
+	return fmt.Sprintf("device with deviceId: %s not found", d.DeviceID)
+}
+
+// Registry keeps track of timing devices. Safe for concurrent use
+//
+// Register adds new device or updates timing point of existing one.
+//
+// Heartbeat marks device as seen and monitored, clockOffset is stored if it's not nil.
+//
+// RecordRead marks device as seen and increments its read count. Unknown devices are registered.
+//
+// All returns all devices sorted by ID.
+//
+// Check marks monitored devices which were not seen for longer than timeout as silent and
+// devices which reported again as online. Returns devices which changed status
+type Registry interface {
+	Register(deviceID, timingPointID string) Device
+	Heartbeat(deviceID string, clockOffset *time.Duration) (Device, error)
+	RecordRead(deviceID, timingPointID string) Device
+	All() []Device
+	Check(timeout time.Duration) []Device
+}
+
+// registry implements Registry
+type registry struct {
+	mu      sync.Mutex
+	devices map[string]*Device
+	now     func() time.Time
+}
+
+func (r *registry) Register(deviceID, timingPointID string) Device {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d, ok := r.devices[deviceID]
+	if !ok {
+		now := r.now()
+		d = &Device{ID: deviceID, Status: StatusOnline, RegisteredAt: now, LastSeen: now}
+		r.devices[deviceID] = d
+	}
+	d.TimingPointID = timingPointID
+	return *d
+}
+
+func (r *registry) Heartbeat(deviceID string, clockOffset *time.Duration) (Device, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d, ok := r.devices[deviceID]
+	if !ok {
+		return Device{}, DeviceNotFound{deviceID}
+	}
+	d.LastSeen = r.now()
+	d.Monitored = true
+	if clockOffset != nil {
+		d.ClockOffsetMS = clockOffset.Milliseconds()
+	}
+	return *d, nil
+}
+
+func (r *registry) RecordRead(deviceID, timingPointID string) Device {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	d, ok := r.devices[deviceID]
+	if !ok {
+		d = &Device{ID: deviceID, TimingPointID: timingPointID, Status: StatusOnline, RegisteredAt: now}
+		r.devices[deviceID] = d
+	}
+	d.LastSeen = now
+	d.Reads++
+	return *d
+}
+
+func (r *registry) All() []Device {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	all := make([]Device, 0, len(r.devices))
+	for _, d := range r.devices {
+		all = append(all, *d)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].ID < all[j].ID })
+	return all
+}
+
+func (r *registry) Check(timeout time.Duration) []Device {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	changed := []Device{}
+	for _, d := range r.devices {
+		status := StatusOnline
+		if d.Monitored && now.Sub(d.LastSeen) > timeout {
+			status = StatusSilent
+		}
+		if status != d.Status {
+			d.Status = status
+			changed = append(changed, *d)
+		}
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i].ID < changed[j].ID })
+	return changed
+}
+
+// NewRegistry initializes empty Registry
+func NewRegistry() Registry {
+	return &registry{devices: map[string]*Device{}, now: time.Now}
+}
+
+// MeasureClockOffset returns difference between server time now and device clock time
+// in 15:04:05.999 format. Adding the offset to device clock time gives server clock time.
+// Offset is normalized to be within 12 hours to handle midnight
+func MeasureClockOffset(clockTime string, now time.Time) (time.Duration, error) {
+	deviceTime, err := time.Parse("15:04:05.999", clockTime)
+	if err != nil {
+		return 0, err
+	}
+	h, m, s := now.Clock()
+	serverTime := time.Date(0, 1, 1, h, m, s, now.Nanosecond(), time.UTC)
+	offset := serverTime.Sub(deviceTime)
+	switch {
+	case offset > 12*time.Hour:
+		offset -= 24 * time.Hour
+	case offset < -12*time.Hour:
+		offset += 24 * time.Hour
+	}
+	return offset, nil
+}
+
+// CorrectClockTime adds offset to clock time in 15:04:05.999 format, wrapping around midnight
+func CorrectClockTime(clockTime string, offset time.Duration) (string, error) {
+	t, err := time.Parse("15:04:05.999", clockTime)
+	if err != nil {
+		return "", err
+	}
+	return t.Add(offset).Format("15:04:05.999"), nil
+}
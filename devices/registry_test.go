@@ -0,0 +1,100 @@
+package devices
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	now := time.Date(2021, 5, 1, 10, 0, 0, 0, time.UTC)
+	r := &registry{devices: map[string]*Device{}, now: func() time.Time { return now }}
+	assert.Implements(t, (*Registry)(nil), r)
+
+	d := r.Register("mat-1", "finish_corridor")
+	assert.Equal(t, Device{ID: "mat-1", TimingPointID: "finish_corridor", Status: StatusOnline, RegisteredAt: now, LastSeen: now}, d)
+
+	_, err := r.Heartbeat("mat-2", nil)
+	assert.Equal(t, DeviceNotFound{"mat-2"}, err)
+
+	now = now.Add(10 * time.Second)
+	offset := -1500 * time.Millisecond
+	d, err = r.Heartbeat("mat-1", &offset)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, now, d.LastSeen)
+	assert.Equal(t, int64(-1500), d.ClockOffsetMS)
+	assert.Equal(t, true, d.Monitored)
+	assert.Equal(t, offset, d.ClockOffset())
+
+	d = r.RecordRead("mat-2", "finish_line")
+	assert.Equal(t, Device{ID: "mat-2", TimingPointID: "finish_line", Status: StatusOnline, RegisteredAt: now, LastSeen: now, Reads: 1}, d)
+	d = r.RecordRead("mat-2", "finish_line")
+	assert.Equal(t, 2, d.Reads)
+
+	all := r.All()
+	assert.Equal(t, 2, len(all))
+	assert.Equal(t, "mat-1", all[0].ID)
+	assert.Equal(t, "mat-2", all[1].ID)
+
+	// Nothing changed
+	assert.Equal(t, []Device{}, r.Check(30*time.Second))
+
+	// mat-1 goes silent
+	now = now.Add(20 * time.Second)
+	r.RecordRead("mat-2", "finish_line")
+	now = now.Add(15 * time.Second)
+	changed := r.Check(30 * time.Second)
+	assert.Equal(t, 1, len(changed))
+	assert.Equal(t, "mat-1", changed[0].ID)
+	assert.Equal(t, StatusSilent, changed[0].Status)
+	assert.Equal(t, []Device{}, r.Check(30*time.Second))
+
+	// mat-1 reports again
+	r.Heartbeat("mat-1", nil)
+	changed = r.Check(30 * time.Second)
+	assert.Equal(t, 1, len(changed))
+	assert.Equal(t, "mat-1", changed[0].ID)
+	assert.Equal(t, StatusOnline, changed[0].Status)
+
+	// mat-2 sends only reads and is not checked
+	now = now.Add(time.Minute)
+	r.Heartbeat("mat-1", nil)
+	assert.Equal(t, []Device{}, r.Check(30*time.Second))
+}
+
+func TestMeasureClockOffset(t *testing.T) {
+	now := time.Date(2021, 5, 1, 10, 0, 0, 0, time.UTC)
+	offset, err := MeasureClockOffset("09:59:58.5", now)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1500*time.Millisecond, offset)
+
+	offset, err = MeasureClockOffset("10:00:03", now)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, -3*time.Second, offset)
+
+	// Around midnight
+	offset, err = MeasureClockOffset("23:59:59", time.Date(2021, 5, 1, 0, 0, 1, 0, time.UTC))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2*time.Second, offset)
+
+	_, err = MeasureClockOffset("10", now)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestCorrectClockTime(t *testing.T) {
+	corrected, err := CorrectClockTime("00:01:10.123", 1500*time.Millisecond)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "00:01:11.623", corrected)
+
+	corrected, err = CorrectClockTime("00:01:10.123", -123*time.Millisecond)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "00:01:10", corrected)
+
+	corrected, err = CorrectClockTime("00:00:01", -2*time.Second)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "23:59:59", corrected)
+
+	_, err = CorrectClockTime("10", time.Second)
+	assert.NotEqual(t, nil, err)
+}
@@ -12,6 +12,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/jackc/pgx/v4"
@@ -21,6 +22,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"gitlab.com/mooncascade/event-timing-server/athletes"
+	"gitlab.com/mooncascade/event-timing-server/cluster"
 	"gitlab.com/mooncascade/event-timing-server/router"
 )
 
@@ -77,7 +79,8 @@ func TestIntegration(t *testing.T) {
 	logger := logrus.New()
 	athletesService, err := athletes.InitService(logger, dbConnectionString)
 	assert.Equal(t, nil, err)
-	r := router.New(logger, athletesService)
+	athletesService.SetAutoStart(true)
+	r := router.New(logger, athletesService, "")
 	ts := httptest.NewServer(r)
 	u, err := url.Parse(ts.URL)
 	if err != nil {
@@ -133,9 +136,8 @@ func TestIntegration(t *testing.T) {
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
 	assert.Equal(t, string(toJSON(t, athletes.SuccessResponse{Message: "updated"})), body)
 
-	// Receive ws update message for client1
-	_, msg, err = client1.ReadMessage()
-	assert.Equal(t, nil, err)
+	// Receive ws update message for client1, race started by the update is skipped
+	msg = readUpdate(t, client1)
 	assert.Equal(t, string(toJSON(t, john)), string(msg))
 
 	// Connect second ws client
@@ -170,13 +172,11 @@ func TestIntegration(t *testing.T) {
 	assert.Equal(t, string(toJSON(t, athletes.SuccessResponse{Message: "updated"})), body)
 
 	// Receive update client1 message
-	_, msg, err = client1.ReadMessage()
-	assert.Equal(t, nil, err)
+	msg = readUpdate(t, client1)
 	assert.Equal(t, string(toJSON(t, rae)), string(msg))
 
 	// Receive update client2 message
-	_, msg, err = client2.ReadMessage()
-	assert.Equal(t, nil, err)
+	msg = readUpdate(t, client2)
 	assert.Equal(t, string(toJSON(t, rae)), string(msg))
 
 	// Send update 3
@@ -221,8 +221,18 @@ func TestIntegration(t *testing.T) {
 	resp, body = testRequest(t, ts, "GET", "/leaderboard", nil)
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
 	assert.Equal(t, string(toJSON(t, leaderboardRows)), body)
+	assert.Equal(t, true, resp.Uncompressed)
+
+	// Leaderboard did not change
+	req, err := http.NewRequest("GET", ts.URL+"/leaderboard", nil)
+	assert.Equal(t, nil, err)
+	req.Header.Set("If-None-Match", resp.Header.Get("ETag"))
+	resp, err = http.DefaultClient.Do(req)
+	assert.Equal(t, nil, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
 
-	// Missing athlete update
+	// Missing athlete update is quarantined
 	updatePayload = `
 	{
 		"chip_id":"aaaaaaaa-e63e-442c-98c4-1be4ac871367",
@@ -231,8 +241,34 @@ func TestIntegration(t *testing.T) {
 	}
 	`
 	resp, body = testRequest(t, ts, "POST", "/update", strings.NewReader(updatePayload))
-	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
-	assert.Equal(t, string(toJSON(t, athletes.ErrorResponse{Error: "athlete with chipId: aaaaaaaa-e63e-442c-98c4-1be4ac871367 not found"})), body)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, string(toJSON(t, athletes.SuccessResponse{Message: "quarantined"})), body)
+
+	resp, body = testRequest(t, ts, "GET", "/unmatched-reads", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var unmatchedReads []athletes.UnmatchedRead
+	assert.Equal(t, nil, json.Unmarshal([]byte(body), &unmatchedReads))
+	assert.Equal(t, 1, len(unmatchedReads))
+	assert.Equal(t, "aaaaaaaa-e63e-442c-98c4-1be4ac871367", unmatchedReads[0].ChipID)
+
+	// Assign quarantined chip to athlete
+	assignPayload := `
+	{
+		"chip_id":"aaaaaaaa-e63e-442c-98c4-1be4ac871367",
+		"start_number": 2
+	}
+	`
+	jonah.FinishCorridor = "00:01:22.321"
+	resp, body = testRequest(t, ts, "POST", "/admin/chips", strings.NewReader(assignPayload))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var assignResponse athletes.AssignChipResponse
+	assert.Equal(t, nil, json.Unmarshal([]byte(body), &assignResponse))
+	assert.Equal(t, jonah.FinishCorridor, assignResponse.Row.FinishCorridor)
+	assert.Equal(t, 1, len(assignResponse.AppliedReads))
+
+	resp, body = testRequest(t, ts, "GET", "/unmatched-reads", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "[]", body)
 
 	// Incomplete update
 	var incompleteUpdatePayloads = []string{
@@ -279,6 +315,23 @@ func toJSON(t *testing.T, v interface{}) []byte {
 	return jsonData
 }
 
+// readUpdate reads WebSocket messages until a leaderboard or row arrives. Messages
+// with type, e.g. race_state sent when the first timing event starts race, are skipped
+func readUpdate(t *testing.T, client *websocket.Conn) []byte {
+	for {
+		_, msg, err := client.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		typed := struct {
+			Type string `json:"type"`
+		}{}
+		if json.Unmarshal(msg, &typed) != nil || typed.Type == "" {
+			return msg
+		}
+	}
+}
+
 func testRequest(t *testing.T, ts *httptest.Server, method, path string, body io.Reader) (*http.Response, string) {
 	req, err := http.NewRequest(method, ts.URL+path, body)
 	if err != nil {
@@ -301,3 +354,62 @@ func testRequest(t *testing.T, ts *httptest.Server, method, path string, body io
 
 	return resp, string(respBody)
 }
+
+func TestCluster(t *testing.T) {
+	logger := logrus.New()
+	servers := []*httptest.Server{}
+	for i := 0; i < 2; i++ {
+		athletesService, err := athletes.InitService(logger, dbConnectionString)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer athletesService.Close()
+		athletesService.SetAutoStart(true)
+		bus, err := cluster.NewPostgresBus(dbConnectionString, cluster.Channel, logger)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		athletesService.JoinCluster(bus)
+		ts := httptest.NewServer(router.New(logger, athletesService, ""))
+		defer ts.Close()
+		servers = append(servers, ts)
+	}
+
+	// Client connected to the second server
+	u, err := url.Parse(servers[1].URL)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	u.Scheme = "ws"
+	client, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("%s/ws", u.String()), nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer client.Close()
+	_, _, err = client.ReadMessage()
+	assert.Equal(t, nil, err)
+
+	// Update posted to the first server
+	updatePayload := `
+	{
+		"chip_id":"e058c321-b904-46ac-a7fb-9bf0ffeb518e",
+		"timing_point_id": "finish_corridor",
+		"clock_time": "00:02:12.321"
+	}
+	`
+	resp, _ := testRequest(t, servers[0], "POST", "/update", strings.NewReader(updatePayload))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Client of the second server receives the update, race started by the update is skipped
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	msg := readUpdate(t, client)
+	row := athletes.LeaderboardRow{}
+	assert.Equal(t, nil, json.Unmarshal(msg, &row))
+	assert.Equal(t, 2, row.StartNumber)
+	assert.Equal(t, "00:02:12.321", row.FinishCorridor)
+
+	// Both servers have the same leaderboard
+	_, first := testRequest(t, servers[0], "GET", "/leaderboard", nil)
+	_, second := testRequest(t, servers[1], "GET", "/leaderboard", nil)
+	assert.Equal(t, first, second)
+}
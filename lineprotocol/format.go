@@ -0,0 +1,114 @@
+package lineprotocol
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Field names which can be used in Format.Fields
+const (
+	FieldChipID        = "chip_id"
+	FieldTimingPointID = "timing_point_id"
+	FieldClockTime     = "clock_time"
+	FieldDeviceID      = "device_id"
+	FieldIgnored       = "-"
+)
+
+// Event is a single timing read parsed from a line
+type Event struct {
+	ChipID        string
+	TimingPointID string
+	ClockTime     string
+	DeviceID      string
+}
+
+// Format describes how a line emitted by a timing decoder is split into an Event.
+//
+// Delimiter separates fields, empty Delimiter splits by any whitespace.
+//
+// Fields lists the meaning of every column in order, columns marked with "-" are skipped.
+// device_id column is optional.
+//
+// Points maps timing point names used by decoder to timing_point_id known by server,
+// e.g. "FL" to "finish_line". Names without mapping are passed as is.
+type Format struct {
+	Delimiter string
+	Fields    []string
+	Points    map[string]string
+}
+
+// DefaultFormat is "chip_id,timing_point_id,clock_time" separated by comma
+var DefaultFormat = Format{
+	Delimiter: ",",
+	Fields:    []string{FieldChipID, FieldTimingPointID, FieldClockTime},
+}
+
+// ParseFormat builds Format from comma separated list of fields, delimiter and
+// comma separated list of point mappings in "name=timing_point_id" form
+func ParseFormat(fields, delimiter, points string) (Format, error) {
+	f := Format{Delimiter: delimiter, Points: map[string]string{}}
+	seen := map[string]bool{}
+	for _, field := range strings.Split(fields, ",") {
+		field = strings.TrimSpace(field)
+		switch field {
+		case FieldChipID, FieldTimingPointID, FieldClockTime, FieldDeviceID:
+			if seen[field] {
+				return Format{}, fmt.Errorf("line format: field %s is defined twice", field)
+			}
+			seen[field] = true
+		case FieldIgnored:
+		default:
+			return Format{}, fmt.Errorf("line format: unknown field %q", field)
+		}
+		f.Fields = append(f.Fields, field)
+	}
+	for _, field := range []string{FieldChipID, FieldTimingPointID, FieldClockTime} {
+		if !seen[field] {
+			return Format{}, fmt.Errorf("line format: field %s is missing", field)
+		}
+	}
+
+	if points == "" {
+		return f, nil
+	}
+	for _, p := range strings.Split(points, ",") {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" || strings.TrimSpace(kv[1]) == "" {
+			return Format{}, fmt.Errorf("line format: invalid point mapping %q", p)
+		}
+		f.Points[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return f, nil
+}
+
+// Parse splits line according to Format and returns parsed Event
+func (f Format) Parse(line string) (Event, error) {
+	var columns []string
+	if f.Delimiter == "" {
+		columns = strings.Fields(line)
+	} else {
+		columns = strings.Split(line, f.Delimiter)
+	}
+	if len(columns) < len(f.Fields) {
+		return Event{}, fmt.Errorf("expected %d fields, got %d", len(f.Fields), len(columns))
+	}
+
+	e := Event{}
+	for i, field := range f.Fields {
+		value := strings.TrimSpace(columns[i])
+		switch field {
+		case FieldChipID:
+			e.ChipID = value
+		case FieldTimingPointID:
+			if point, ok := f.Points[value]; ok {
+				value = point
+			}
+			e.TimingPointID = value
+		case FieldClockTime:
+			e.ClockTime = value
+		case FieldDeviceID:
+			e.DeviceID = value
+		}
+	}
+	return e, nil
+}
@@ -0,0 +1,147 @@
+package lineprotocol
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFormat(t *testing.T) {
+	f, err := ParseFormat("chip_id,timing_point_id,clock_time", ",", "")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, DefaultFormat.Fields, f.Fields)
+	assert.Equal(t, ",", f.Delimiter)
+
+	f, err = ParseFormat("-,clock_time,chip_id,timing_point_id", "", "FC=finish_corridor, FL=finish_line")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"-", "clock_time", "chip_id", "timing_point_id"}, f.Fields)
+	assert.Equal(t, map[string]string{"FC": "finish_corridor", "FL": "finish_line"}, f.Points)
+
+	_, err = ParseFormat("chip_id,clock_time", ",", "")
+	assert.Equal(t, "line format: field timing_point_id is missing", err.Error())
+
+	_, err = ParseFormat("chip_id,chip_id,timing_point_id,clock_time", ",", "")
+	assert.Equal(t, "line format: field chip_id is defined twice", err.Error())
+
+	_, err = ParseFormat("chip,timing_point_id,clock_time", ",", "")
+	assert.Equal(t, `line format: unknown field "chip"`, err.Error())
+
+	_, err = ParseFormat("chip_id,timing_point_id,clock_time", ",", "FC")
+	assert.Equal(t, `line format: invalid point mapping "FC"`, err.Error())
+}
+
+func TestParse(t *testing.T) {
+	expected := Event{"d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17", "finish_line", "00:01:10.123", ""}
+
+	e, err := DefaultFormat.Parse("d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17, finish_line, 00:01:10.123")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, expected, e)
+
+	f, _ := ParseFormat("-,clock_time,chip_id,timing_point_id", "", "FL=finish_line")
+	e, err = f.Parse("42  00:01:10.123\td42ebbc6-5b2b-4ff9-83a6-7df87cc20c17 FL")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, expected, e)
+
+	f, _ = ParseFormat("device_id,chip_id,timing_point_id,clock_time", ";", "")
+	e, err = f.Parse("mat-1;d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17;finish_line;00:01:10.123")
+	assert.Equal(t, nil, err)
+	expected.DeviceID = "mat-1"
+	assert.Equal(t, expected, e)
+
+	_, err = DefaultFormat.Parse("d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17,finish_line")
+	assert.Equal(t, "expected 3 fields, got 2", err.Error())
+}
+
+func TestListener(t *testing.T) {
+	received := make(chan Event, 1)
+	handler := func(e Event) error {
+		if e.TimingPointID != "finish_line" {
+			return fmt.Errorf("unknown timing point %s", e.TimingPointID)
+		}
+		received <- e
+		return nil
+	}
+	l, err := Listen("127.0.0.1:0", DefaultFormat, handler, logrus.New())
+	assert.Equal(t, nil, err)
+	go l.Serve()
+	defer l.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	fmt.Fprint(conn, "chip1,finish_line,00:01:10.123\r\n\n")
+	ack, err := reader.ReadString('\n')
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "OK\n", ack)
+	assert.Equal(t, Event{"chip1", "finish_line", "00:01:10.123", "127.0.0.1"}, <-received)
+
+	fmt.Fprint(conn, "chip1,start,00:01:10.123\n")
+	ack, err = reader.ReadString('\n')
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "ERR unknown timing point start\n", ack)
+
+	fmt.Fprint(conn, "chip1\n")
+	ack, err = reader.ReadString('\n')
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "ERR expected 3 fields, got 1\n", ack)
+}
+
+func TestListenerShutdown(t *testing.T) {
+	processing := make(chan bool)
+	release := make(chan bool)
+	handler := func(e Event) error {
+		processing <- true
+		<-release
+		return nil
+	}
+	l, err := Listen("127.0.0.1:0", DefaultFormat, handler, logrus.New())
+	assert.Equal(t, nil, err)
+	go l.Serve()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	fmt.Fprint(conn, "chip1,finish_line,00:01:10.123\n")
+	<-processing
+
+	shutdownErr := make(chan error)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdownErr <- l.Shutdown(ctx)
+	}()
+
+	// New connections are refused once shutdown started
+	for {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			break
+		}
+		c.Close()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Line being processed is acknowledged, then connection is closed
+	close(release)
+	ack, err := reader.ReadString('\n')
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "OK\n", ack)
+	_, err = reader.ReadString('\n')
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, nil, <-shutdownErr)
+}
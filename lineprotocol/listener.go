@@ -0,0 +1,175 @@
+package lineprotocol
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Handler processes parsed Event. Returned error is sent back to decoder
+type Handler func(Event) error
+
+// Listener accepts TCP connections from timing decoders sending one
+// timing read per line. Every line is acknowledged with "OK" or "ERR <reason>".
+// If line format has no device_id, decoder host is used as Event.DeviceID.
+// Connected decoders are tracked in conns guarded by mu until Shutdown
+type Listener struct {
+	listener net.Listener
+	format   Format
+	handler  Handler
+	logger   *logrus.Logger
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+	closing  bool
+	wg       sync.WaitGroup
+}
+
+// Listen starts listening on addr, connections are not accepted until Serve is called
+func Listen(addr string, format Format, handler Handler, logger *logrus.Logger) (*Listener, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Listener{
+		listener: l,
+		format:   format,
+		handler:  handler,
+		logger:   logger,
+		conns:    map[net.Conn]struct{}{},
+	}, nil
+}
+
+// Addr returns listener network address
+func (l *Listener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+// Serve accepts incoming connections and handles each one in a separate goroutine.
+// Returns nil after Close was called
+func (l *Listener) Serve() error {
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		if !l.track(conn) {
+			conn.Close()
+			continue
+		}
+		go l.handleConn(conn)
+	}
+}
+
+// Close stops accepting new connections
+func (l *Listener) Close() error {
+	return l.listener.Close()
+}
+
+// Shutdown stops accepting new connections and stops reading from connected decoders.
+// Lines already received are processed and acknowledged before connection is closed.
+// Waits for all connections to be closed, remaining connections are closed once ctx is done
+func (l *Listener) Shutdown(ctx context.Context) error {
+	err := l.listener.Close()
+	if errors.Is(err, net.ErrClosed) {
+		err = nil
+	}
+	l.mu.Lock()
+	l.closing = true
+	for conn := range l.conns {
+		// Unblocks pending read, line being processed is still acknowledged
+		conn.SetReadDeadline(time.Now())
+	}
+	l.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		l.mu.Lock()
+		for conn := range l.conns {
+			conn.Close()
+		}
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// track adds conn to connected decoders, returns false if listener is shutting down
+func (l *Listener) track(conn net.Conn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closing {
+		return false
+	}
+	l.conns[conn] = struct{}{}
+	l.wg.Add(1)
+	return true
+}
+
+func (l *Listener) untrack(conn net.Conn) {
+	l.mu.Lock()
+	delete(l.conns, conn)
+	l.mu.Unlock()
+	l.wg.Done()
+}
+
+// handleConn reads lines until connection is closed, empty lines are skipped
+func (l *Listener) handleConn(conn net.Conn) {
+	defer l.untrack(conn)
+	defer conn.Close()
+	remote := conn.RemoteAddr().String()
+	host, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		host = remote
+	}
+	l.logger.Infof("Decoder %s: connected", remote)
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		ack := "OK\n"
+		if err := l.handleLine(line, host); err != nil {
+			l.logger.Warnf("Decoder %s: %q: %v", remote, line, err)
+			ack = fmt.Sprintf("ERR %s\n", strings.ReplaceAll(err.Error(), "\n", " "))
+		}
+		if _, err := conn.Write([]byte(ack)); err != nil {
+			l.logger.Errorf("Decoder %s: %v", remote, err)
+			return
+		}
+	}
+	if err := scanner.Err(); errors.Is(err, os.ErrDeadlineExceeded) {
+		l.logger.Infof("Decoder %s: server is shutting down", remote)
+	} else if err != nil {
+		l.logger.Errorf("Decoder %s: %v", remote, err)
+	}
+	l.logger.Infof("Decoder %s: disconnected", remote)
+}
+
+func (l *Listener) handleLine(line, host string) error {
+	e, err := l.format.Parse(line)
+	if err != nil {
+		return err
+	}
+	if e.DeviceID == "" {
+		e.DeviceID = host
+	}
+	return l.handler(e)
+}
@@ -0,0 +1,72 @@
+package logging
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Components of the server which can have their own log level
+const (
+	HTTP         = "http"
+	Athletes     = "athletes"
+	WebSocket    = "websocket"
+	LineProtocol = "lineprotocol"
+	Cluster      = "cluster"
+)
+
+// Components lists all components
+var Components = []string{HTTP, Athletes, WebSocket, LineProtocol, Cluster}
+
+// TimestampFormat of log entries
+const TimestampFormat = "2006-01-02T15:04:05.9999Z07:00"
+
+// Configure sets level and format, text or json, of logger
+func Configure(logger *logrus.Logger, level, format string) error {
+	l, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	logger.SetLevel(l)
+	switch format {
+	case "text":
+		logger.SetFormatter(&logrus.TextFormatter{TimestampFormat: TimestampFormat, FullTimestamp: true})
+	case "json":
+		logger.SetFormatter(&logrus.JSONFormatter{TimestampFormat: TimestampFormat})
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+	return nil
+}
+
+// Component returns logger of component writing to output of root with its formatter.
+// Level is taken from levels by component name, level of root is used if it is not set.
+// Every entry has component field
+func Component(root *logrus.Logger, name string, levels map[string]string) (*logrus.Logger, error) {
+	logger := logrus.New()
+	logger.SetOutput(root.Out)
+	logger.SetFormatter(root.Formatter)
+	logger.SetReportCaller(root.ReportCaller)
+	logger.SetLevel(root.GetLevel())
+	if level, ok := levels[name]; ok {
+		l, err := logrus.ParseLevel(level)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		logger.SetLevel(l)
+	}
+	logger.AddHook(componentHook(name))
+	return logger, nil
+}
+
+// componentHook adds component field to every entry
+type componentHook string
+
+func (h componentHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h componentHook) Fire(entry *logrus.Entry) error {
+	entry.Data["component"] = string(h)
+	return nil
+}
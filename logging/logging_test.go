@@ -0,0 +1,53 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComponent(t *testing.T) {
+	out := &bytes.Buffer{}
+	root := logrus.New()
+	root.SetOutput(out)
+	assert.Equal(t, nil, Configure(root, "info", "json"))
+	assert.NotEqual(t, nil, Configure(root, "verbose", "json"))
+	assert.NotEqual(t, nil, Configure(root, "info", "xml"))
+
+	levels := map[string]string{WebSocket: "warn", Cluster: "debug"}
+	ws, err := Component(root, WebSocket, levels)
+	assert.Equal(t, nil, err)
+	cluster, err := Component(root, Cluster, levels)
+	assert.Equal(t, nil, err)
+	http, err := Component(root, HTTP, levels)
+	assert.Equal(t, nil, err)
+
+	ws.Info("dropped")
+	ws.Warn("websocket warning")
+	cluster.Debug("cluster debug")
+	http.Debug("dropped")
+	http.WithField("request_id", "abc").Info("request")
+	root.Info("root")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Equal(t, 4, len(lines))
+	entries := []map[string]string{}
+	for _, line := range lines {
+		entry := map[string]string{}
+		assert.Equal(t, nil, json.Unmarshal([]byte(line), &entry))
+		entries = append(entries, entry)
+	}
+	assert.Equal(t, "websocket", entries[0]["component"])
+	assert.Equal(t, "websocket warning", entries[0]["msg"])
+	assert.Equal(t, "cluster", entries[1]["component"])
+	assert.Equal(t, "abc", entries[2]["request_id"])
+	assert.Equal(t, "http", entries[2]["component"])
+	assert.Equal(t, "", entries[3]["component"])
+
+	_, err = Component(root, Athletes, map[string]string{Athletes: "loud"})
+	assert.NotEqual(t, nil, err)
+}
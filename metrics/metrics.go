@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "event_timing"
+
+// Results of timing events
+const (
+	ResultAccepted    = "accepted"
+	ResultRejected    = "rejected"
+	ResultQuarantined = "quarantined"
+)
+
+var (
+	// HTTPRequests counts http requests by method, route pattern and status code
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of http requests by method, route and status code.",
+	}, []string{"method", "route", "code"})
+
+	// HTTPDuration observes http request latency by method and route pattern
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of http requests by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// TimingEvents counts timing events by result, reason of rejection and timing point
+	TimingEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "timing_events_total",
+		Help:      "Number of timing events by result, reason and timing point.",
+	}, []string{"result", "reason", "timing_point"})
+
+	// WSClients is the number of connected ws clients
+	WSClients = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ws_clients",
+		Help:      "Number of connected WebSocket clients.",
+	})
+
+	// BroadcastQueue is the number of ws messages waiting to be sent
+	BroadcastQueue = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ws_broadcast_queue",
+		Help:      "Number of WebSocket messages waiting to be sent to clients.",
+	})
+
+	// LeaderboardSize is the number of athletes on leaderboard
+	LeaderboardSize = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "leaderboard_size",
+		Help:      "Number of athletes on leaderboard.",
+	})
+
+	// DBQueryDuration observes store query latency by query name
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Latency of database queries by query.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"query"})
+)
+
+// Handler serves metrics in Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// TimingPoint returns timingPointID if it is a known timing point, "unknown" otherwise.
+// Keeps label values of TimingEvents bounded
+func TimingPoint(timingPointID string) string {
+	if timingPointID == "finish_corridor" || timingPointID == "finish_line" {
+		return timingPointID
+	}
+	return "unknown"
+}
+
+// ObserveQuery starts timer of query and returns function which observes its duration,
+// e.g. defer metrics.ObserveQuery("find_all")()
+func ObserveQuery(query string) func() {
+	start := time.Now()
+	return func() {
+		DBQueryDuration.WithLabelValues(query).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Middleware counts requests and observes their latency. Requests are labeled
+// by chi route pattern, not by path, to keep label values bounded
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		code := ww.Status()
+		if code == 0 {
+			code = http.StatusOK
+		}
+		HTTPRequests.WithLabelValues(r.Method, route, strconv.Itoa(code)).Inc()
+		HTTPDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/athletes/{bib}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	r.Get("/metrics", Handler().ServeHTTP)
+
+	// Collectors are global, only changes made by this test are checked
+	athlete := HTTPRequests.WithLabelValues("GET", "/athletes/{bib}", "404")
+	unmatched := HTTPRequests.WithLabelValues("GET", "unmatched", "404")
+	athleteBefore, unmatchedBefore := testutil.ToFloat64(athlete), testutil.ToFloat64(unmatched)
+	countBefore := durationCount(t, r)
+
+	for _, bib := range []string{"1", "2", "3"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/athletes/"+bib, nil))
+	}
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+	assert.Equal(t, athleteBefore+3, testutil.ToFloat64(athlete))
+	assert.Equal(t, unmatchedBefore+1, testutil.ToFloat64(unmatched))
+	assert.Equal(t, countBefore+3, durationCount(t, r))
+}
+
+// durationCount returns number of /athletes/{bib} requests observed by HTTPDuration
+// as exposed by /metrics route of r
+func durationCount(t *testing.T, r http.Handler) int {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	prefix := `event_timing_http_request_duration_seconds_count{method="GET",route="/athletes/{bib}"} `
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if strings.HasPrefix(line, prefix) {
+			count, err := strconv.Atoi(strings.TrimPrefix(line, prefix))
+			assert.Equal(t, nil, err)
+			return count
+		}
+	}
+	return 0
+}
+
+func TestObserveQuery(t *testing.T) {
+	ObserveQuery("test_query")()
+	assert.Equal(t, 1, testutil.CollectAndCount(DBQueryDuration))
+}
+
+func TestTimingPoint(t *testing.T) {
+	assert.Equal(t, "finish_line", TimingPoint("finish_line"))
+	assert.Equal(t, "finish_corridor", TimingPoint("finish_corridor"))
+	assert.Equal(t, "unknown", TimingPoint("start"))
+}
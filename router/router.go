@@ -1,6 +1,8 @@
 package router
 
 import (
+	"crypto/subtle"
+	"encoding/json"
 	"net"
 	"net/http"
 	"strings"
@@ -11,15 +13,48 @@ import (
 	openapi "github.com/go-openapi/runtime/middleware"
 	"github.com/sirupsen/logrus"
 	"gitlab.com/mooncascade/event-timing-server/athletes"
+	"gitlab.com/mooncascade/event-timing-server/metrics"
 )
 
-// New initializes router with provided service and logger
-func New(logger *logrus.Logger, service *athletes.Service) *chi.Mux {
+// New initializes router with provided service and logger. deviceMiddlewares, e.g.
+// certs.RequireClientCert, are used by endpoints of timing devices and by /admin
+// endpoints, as they also apply timing reads and change state of the event.
+// /admin endpoints also require adminToken as bearer token if it is set
+func New(logger *logrus.Logger, service *athletes.Service, adminToken string, deviceMiddlewares ...func(http.Handler) http.Handler) *chi.Mux {
 	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
 	r.Use(loggerMiddleware(logger))
-	r.Post("/update", service.ReceiveTimingEventHandler())
-	r.Get("/leaderboard", service.LeaderboardHandler())
+	r.Use(metrics.Middleware)
+	r.Get("/metrics", metrics.Handler().ServeHTTP)
+	r.Get("/healthz", service.HealthzHandler())
+	r.Get("/readyz", service.ReadyzHandler())
+	r.With(middleware.Compress(5, "application/json")).Get("/leaderboard", service.LeaderboardHandler())
+	r.Get("/anomalies", service.AnomaliesHandler())
+	r.With(middleware.Compress(5, "application/json")).Get("/athletes/{bib}", service.AthleteHandler())
 	r.Get("/ws", service.WSHandler())
+	r.Get("/unmatched-reads", service.UnmatchedReadsHandler())
+	r.Get("/race", service.RaceHandler())
+	r.Get("/waves", service.WavesHandler())
+	r.Get("/devices", service.DevicesHandler())
+	r.Group(func(r chi.Router) {
+		r.Use(deviceMiddlewares...)
+		r.Group(func(r chi.Router) {
+			if adminToken != "" {
+				r.Use(requireToken(adminToken))
+			}
+			r.Post("/admin/replay", service.ReplayHandler())
+			r.Get("/admin/chips", service.ChipsHandler())
+			r.Post("/admin/chips", service.AssignChipHandler())
+			r.Delete("/admin/chips/{chipID}", service.UnassignChipHandler())
+			r.Post("/admin/roster/reload", service.ReloadRosterHandler())
+			r.Post("/admin/race/{action}", service.RaceTransitionHandler())
+			r.Post("/admin/waves/{wave}/start", service.StartWaveHandler())
+		})
+		r.Post("/update", service.ReceiveTimingEventHandler())
+		r.Post("/devices", service.RegisterDeviceHandler())
+		r.Post("/devices/{deviceID}/heartbeat", service.DeviceHeartbeatHandler())
+		r.Post("/devices/{deviceID}/sync", service.DeviceSyncHandler())
+	})
 	r.Get("/openapi", func(w http.ResponseWriter, r *http.Request) {
 		openapi.Redoc(openapi.RedocOpts{Title: "Event timing server API", SpecURL: "docs/openapi.json", Path: "openapi"}, nil).ServeHTTP(w, r)
 	})
@@ -44,9 +79,33 @@ func fileServer(r chi.Router) {
 	})
 }
 
+// requireToken responds with 401 status to requests without token in
+// "Authorization: Bearer <token>" header
+func requireToken(token string) func(http.Handler) http.Handler {
+	expected := []byte("Bearer " + token)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+				jsonData, _ := json.Marshal(map[string]string{"error": "admin token required"})
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write(jsonData)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// loggerMiddleware logs every request with its request ID, which is generated by
+// middleware.RequestID or taken from X-Request-Id request header, and returns
+// request ID in X-Request-Id response header
 func loggerMiddleware(logger *logrus.Logger) func(h http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
+			requestID := middleware.GetReqID(r.Context())
+			w.Header().Set(middleware.RequestIDHeader, requestID)
 			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
 			t1 := time.Now()
 			defer func() {
@@ -59,11 +118,12 @@ func loggerMiddleware(logger *logrus.Logger) func(h http.Handler) http.Handler {
 					scheme = "https"
 				}
 				fields := logrus.Fields{
-					"status":    ww.Status(),
-					"duration":  time.Since(t1).String(),
-					"remote_ip": remoteIP,
-					"proto":     r.Proto,
-					"method":    r.Method,
+					"status":     ww.Status(),
+					"duration":   time.Since(t1).String(),
+					"remote_ip":  remoteIP,
+					"proto":      r.Proto,
+					"method":     r.Method,
+					"request_id": requestID,
 				}
 				logger.WithFields(fields).Infof("%s://%s%s", scheme, r.Host, r.RequestURI)
 			}()
@@ -0,0 +1,81 @@
+package router
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/mooncascade/event-timing-server/athletes"
+	"gitlab.com/mooncascade/event-timing-server/certs"
+)
+
+func TestDeviceMiddlewares(t *testing.T) {
+	service, err := athletes.InitService(logrus.New(), "memory://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer service.Close()
+	r := New(logrus.New(), service, "", certs.RequireClientCert)
+
+	serve := func(method, path string, withCert bool) int {
+		req := httptest.NewRequest(method, path, nil)
+		if withCert {
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Endpoints applying timing reads or changing state require client certificate
+	for _, route := range []struct{ method, path string }{
+		{"POST", "/update"},
+		{"POST", "/devices"},
+		{"POST", "/devices/reader-1/heartbeat"},
+		{"POST", "/devices/reader-1/sync"},
+		{"POST", "/admin/replay"},
+		{"GET", "/admin/chips"},
+		{"POST", "/admin/chips"},
+		{"DELETE", "/admin/chips/d42ebbc6-5b2b-4ff9-83a6-7df87cc20c17"},
+		{"POST", "/admin/roster/reload"},
+		{"POST", "/admin/race/start"},
+		{"POST", "/admin/waves/A/start"},
+	} {
+		assert.Equal(t, http.StatusUnauthorized, serve(route.method, route.path, false), route.path)
+	}
+	assert.Equal(t, http.StatusOK, serve("GET", "/admin/chips", true))
+
+	// Read-only endpoints stay public
+	for _, path := range []string{"/leaderboard", "/race", "/waves", "/devices"} {
+		assert.Equal(t, http.StatusOK, serve("GET", path, false), path)
+	}
+}
+
+func TestAdminToken(t *testing.T) {
+	service, err := athletes.InitService(logrus.New(), "memory://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer service.Close()
+	r := New(logrus.New(), service, "secret")
+
+	serve := func(path, authorization string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Admin endpoints require token without client certificates
+	assert.Equal(t, http.StatusUnauthorized, serve("/admin/chips", ""))
+	assert.Equal(t, http.StatusUnauthorized, serve("/admin/chips", "Bearer wrong"))
+	assert.Equal(t, http.StatusOK, serve("/admin/chips", "Bearer secret"))
+	assert.Equal(t, http.StatusOK, serve("/leaderboard", ""))
+}
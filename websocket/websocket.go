@@ -1,76 +1,205 @@
 package websocket
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/sirupsen/logrus"
+	"gitlab.com/mooncascade/event-timing-server/metrics"
 )
 
-var upgrader = websocket.Upgrader{}
-
 // WSManager manages WebSocket connections for athletes.Service
 //
 // AddClient adds new client to the map of connected clients and returns unique clientID
 //
+// AddSubscriber adds new client which receives only messages sent to topic and returns unique clientID
+//
 // StartClient calls start method for the connectedWSClient.
 //
-// SendMessageToAll connected clients
+// SendMessageToAll connected clients except subscribers
 //
 // SendMessageToOne client specified by clientID
 //
+// SendMessageToTopic subscribers of topic
+//
+// HasSubscribers reports whether any client is subscribed to topic
+//
 // Upgrade upgrades http connection to ws by calling websocket.Upgrader.Upgrade.
-// Also does origin check, but currently all requests are permitted.
+// Also does origin and number of clients check, see Limits
+//
+// SetLimits sets Limits checked by Upgrade
+//
+// SetMessageSampling sets sampling of outbound messages logged at debug level, see sampler
+//
+// Shutdown sends close frame with reason to all clients and waits for them to disconnect
 type WSManager interface {
 	AddClient(*websocket.Conn, *logrus.Logger) string
+	AddSubscriber(*websocket.Conn, *logrus.Logger, string) string
 	StartClient(string)
 	SendMessageToAll([]byte)
 	SendMessageToOne([]byte, string)
+	SendMessageToTopic([]byte, string)
+	HasSubscribers(string) bool
 	Upgrade(http.ResponseWriter, *http.Request, http.Header) (*websocket.Conn, error)
+	SetLimits(Limits)
+	SetMessageSampling(int)
+	Shutdown(context.Context, string) error
+}
+
+// Limits of WebSocket connections. MaxClients is the maximum number of connected
+// clients, 0 means no limit. Only requests with Origin header from AllowedOrigins
+// are upgraded, empty AllowedOrigins or "*" allows all origins
+type Limits struct {
+	MaxClients     int
+	AllowedOrigins []string
+}
+
+// allowsOrigin reports whether request from origin is permitted.
+// Requests without Origin header are not sent by browsers and are permitted
+func (l Limits) allowsOrigin(origin string) bool {
+	if origin == "" || len(l.AllowedOrigins) == 0 {
+		return true
+	}
+	for _, allowed := range l.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// TooManyClients .
+type TooManyClients struct {
+	MaxClients int
+}
+
+func (e TooManyClients) Error() string {
+	return fmt.Sprintf("too many clients, limit is %d", e.MaxClients)
+}
+
+// sampler passes one of every n calls of sample, n less than 2 passes all calls.
+// Used to log only part of high-volume messages sent to clients
+type sampler struct {
+	every uint64
+	count uint64
+}
+
+func (s *sampler) sample() bool {
+	every := atomic.LoadUint64(&s.every)
+	return every < 2 || atomic.AddUint64(&s.count, 1)%every == 1
 }
 
+// closeWriteTimeout limits time of writing close frame to a client
+const closeWriteTimeout = time.Second
+
+// shutdownPollInterval is the interval of checking whether all clients disconnected during Shutdown
+const shutdownPollInterval = 50 * time.Millisecond
+
 // wsManager implements WSManager.
-// Also holds map of connected WebSocket clients and closeWS channel
+// Also holds map of connected WebSocket clients and limits guarded by mu and closeWS channel
 type wsManager struct {
 	connectedWSClients map[string]connectedWSClient
 	closeWS            chan string
+	mu                 *sync.RWMutex
+	limits             *Limits
+	sampler            *sampler
 }
 
 func (wsm wsManager) AddClient(ws *websocket.Conn, logger *logrus.Logger) string {
+	return wsm.AddSubscriber(ws, logger, "")
+}
+
+// AddSubscriber adds client subscribed to topic, empty topic adds a regular client
+func (wsm wsManager) AddSubscriber(ws *websocket.Conn, logger *logrus.Logger, topic string) string {
 	clientID := uuid.New().String()
-	logger.Infof("Client %s: connected", clientID)
+	if topic == "" {
+		logger.Infof("Client %s: connected", clientID)
+	} else {
+		logger.Infof("Client %s: connected, subscribed to %s", clientID, topic)
+	}
 	client := connectedWSClient{
 		UUID:               clientID,
 		Conn:               ws,
 		ReceivedDisconnect: make(chan bool),
 		SendUpdates:        make(chan []byte),
+		removed:            make(chan struct{}),
+		Topic:              topic,
 		logger:             logger,
+		sampler:            wsm.sampler,
 	}
+	wsm.mu.Lock()
 	wsm.connectedWSClients[clientID] = client
+	wsm.mu.Unlock()
+	metrics.WSClients.Inc()
 	return client.UUID
 }
 
 // StartClient calls start method for the connectedWSClient. Once start method returned,
 // sends clientID to wsManager.closeWS channel
 func (wsm wsManager) StartClient(clientID string) {
-	wsm.connectedWSClients[clientID].start()
+	wsm.mu.RLock()
+	client := wsm.connectedWSClients[clientID]
+	wsm.mu.RUnlock()
+	client.start()
 	wsm.closeWS <- clientID
 }
 
 func (wsm wsManager) SendMessageToAll(msg []byte) {
+	wsm.SendMessageToTopic(msg, "")
+}
+
+func (wsm wsManager) SendMessageToOne(msg []byte, clientID string) {
+	wsm.mu.RLock()
+	client, ok := wsm.connectedWSClients[clientID]
+	wsm.mu.RUnlock()
+	if ok {
+		go client.send(msg)
+	}
+}
+
+func (wsm wsManager) SendMessageToTopic(msg []byte, topic string) {
+	wsm.mu.RLock()
+	defer wsm.mu.RUnlock()
 	for _, client := range wsm.connectedWSClients {
-		go func(client connectedWSClient) { client.SendUpdates <- msg }(client)
+		if client.Topic == topic {
+			go client.send(msg)
+		}
 	}
 }
 
-func (wsm wsManager) SendMessageToOne(msg []byte, clientID string) {
-	go func() { wsm.connectedWSClients[clientID].SendUpdates <- msg }()
+func (wsm wsManager) HasSubscribers(topic string) bool {
+	wsm.mu.RLock()
+	defer wsm.mu.RUnlock()
+	for _, client := range wsm.connectedWSClients {
+		if client.Topic == topic {
+			return true
+		}
+	}
+	return false
 }
 
+// Upgrade responds with 503 status and returns TooManyClients error if MaxClients are connected,
+// requests from origins not in AllowedOrigins are responded with 403 status
 func (wsm wsManager) Upgrade(w http.ResponseWriter, r *http.Request, h http.Header) (*websocket.Conn, error) {
-	// Allow all requests
-	upgrader.CheckOrigin = func(r *http.Request) bool { return true }
+	wsm.mu.RLock()
+	limits := *wsm.limits
+	clients := len(wsm.connectedWSClients)
+	wsm.mu.RUnlock()
+	if limits.MaxClients > 0 && clients >= limits.MaxClients {
+		err := TooManyClients{limits.MaxClients}
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return nil, err
+	}
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return limits.allowsOrigin(r.Header.Get("Origin")) },
+	}
 	ws, err := upgrader.Upgrade(w, r, h)
 	if err != nil {
 		return nil, err
@@ -78,32 +207,102 @@ func (wsm wsManager) Upgrade(w http.ResponseWriter, r *http.Request, h http.Head
 	return ws, nil
 }
 
+func (wsm wsManager) SetLimits(limits Limits) {
+	wsm.mu.Lock()
+	*wsm.limits = limits
+	wsm.mu.Unlock()
+}
+
+// SetMessageSampling logs one of every n outbound messages
+func (wsm wsManager) SetMessageSampling(n int) {
+	if n < 0 {
+		n = 0
+	}
+	atomic.StoreUint64(&wsm.sampler.every, uint64(n))
+}
+
+// Shutdown sends close frame with "service restart" code and reason to every client.
+// Clients are removed once they acknowledge the close frame, connections of
+// remaining clients are closed once ctx is done
+func (wsm wsManager) Shutdown(ctx context.Context, reason string) error {
+	msg := websocket.FormatCloseMessage(websocket.CloseServiceRestart, reason)
+	wsm.mu.RLock()
+	for _, client := range wsm.connectedWSClients {
+		if err := client.Conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(closeWriteTimeout)); err != nil {
+			client.logger.Errorf("Client %s: %v", client.UUID, err.Error())
+			client.Conn.Close()
+		}
+	}
+	wsm.mu.RUnlock()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		wsm.mu.RLock()
+		remaining := len(wsm.connectedWSClients)
+		wsm.mu.RUnlock()
+		if remaining == 0 {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			wsm.mu.RLock()
+			for _, client := range wsm.connectedWSClients {
+				client.Conn.Close()
+			}
+			wsm.mu.RUnlock()
+			return ctx.Err()
+		}
+	}
+}
+
 // NewWSManager initializes WSManager object and
 // starts goroutine for cleanup process.
 //
 // Cleanup goroutine listens to wsManager.closeWS channel and removing
-// clients from wsManager.connectedWSClients map by received clientID
+// clients from wsManager.connectedWSClients map by received clientID.
+// SendUpdates of removed client is never closed as messages may still be
+// queued by send, removed channel is closed instead
 func NewWSManager() WSManager {
-	wsm := wsManager{map[string]connectedWSClient{}, make(chan string)}
+	wsm := wsManager{map[string]connectedWSClient{}, make(chan string), &sync.RWMutex{}, &Limits{}, &sampler{}}
 	// Start cleanup goroutine
 	go func(ws wsManager) {
 		for uuid := range ws.closeWS {
+			ws.mu.Lock()
 			client := ws.connectedWSClients[uuid]
-			client.Conn.Close()
-			close(client.ReceivedDisconnect)
-			close(client.SendUpdates)
 			delete(ws.connectedWSClients, uuid)
+			ws.mu.Unlock()
+			metrics.WSClients.Dec()
+			client.Conn.Close()
+			close(client.removed)
 		}
 	}(wsm)
 	return wsm
 }
 
+// connectedWSClient is a WebSocket connection, removed is closed once client is
+// removed from wsManager and no more messages are taken from SendUpdates
 type connectedWSClient struct {
 	UUID               string
 	Conn               *websocket.Conn
 	SendUpdates        chan []byte
 	ReceivedDisconnect chan bool
+	removed            chan struct{}
+	Topic              string
 	logger             *logrus.Logger
+	sampler            *sampler
+}
+
+// send queues msg to be sent by sendMessage, counted in metrics.BroadcastQueue until it is taken.
+// msg is dropped if client is removed before it is taken
+func (client connectedWSClient) send(msg []byte) {
+	metrics.BroadcastQueue.Inc()
+	defer metrics.BroadcastQueue.Dec()
+	select {
+	case client.SendUpdates <- msg:
+	case <-client.removed:
+	}
 }
 
 // start starts sendMessage and readMessage goroutines.
@@ -116,14 +315,14 @@ func (client connectedWSClient) start() {
 }
 
 // readMessage starts loop to constantly read incoming message from client.
-// All messages are discarded. In case of error, signals client.ReceivedDisconnect channel.
+// All messages are discarded. In case of error, closes client.ReceivedDisconnect channel.
 func (client connectedWSClient) readMessage() {
 	for {
 		_, _, err := client.Conn.ReadMessage()
 		if err != nil {
 			client.logger.Infof("Client %s: %v", client.UUID, err.Error())
 			client.logger.Infof("Client %s: closing WS connection", client.UUID)
-			client.ReceivedDisconnect <- true
+			close(client.ReceivedDisconnect)
 			return
 		}
 	}
@@ -136,7 +335,7 @@ func (client connectedWSClient) readMessage() {
 // signals done channel and returns
 //
 // Receiving from client.SendUpdates, sends ws message to the client. In case of an error,
-// signal doen channel and return
+// signal doen channel and return. Sampled messages are logged at debug level
 func (client connectedWSClient) sendMessage(done chan bool) {
 	for {
 		select {
@@ -144,7 +343,9 @@ func (client connectedWSClient) sendMessage(done chan bool) {
 			done <- true
 			return
 		case msg := <-client.SendUpdates:
-			client.logger.Infof("Client %s: sending message %s", client.UUID, string(msg))
+			if client.sampler.sample() {
+				client.logger.Debugf("Client %s: sending message %s", client.UUID, string(msg))
+			}
 			err := client.Conn.WriteMessage(websocket.TextMessage, msg)
 			if err != nil {
 				client.logger.Errorf("Client %s: %v", client.UUID, err.Error())
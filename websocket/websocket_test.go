@@ -1,16 +1,20 @@
 package websocket
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"gitlab.com/mooncascade/event-timing-server/metrics"
 )
 
 var wsm WSManager
@@ -79,3 +83,191 @@ func TestWebSocketManager(t *testing.T) {
 	assert.Equal(t, nil, err)
 	assert.Equal(t, updateMsg2, string(msg))
 }
+
+func TestWebSocketSubscriber(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := wsm.Upgrade(w, r, nil)
+		if err != nil {
+			log.Fatal(err.Error())
+			return
+		}
+		clientID := wsm.AddSubscriber(ws, logrus.New(), r.URL.Query().Get("topic"))
+		go wsm.SendMessageToOne([]byte(firstMsg), clientID)
+		wsm.StartClient(clientID)
+	}))
+	defer s.Close()
+
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	u.Scheme = "ws"
+	u.RawQuery = "topic=athlete:2"
+
+	assert.Equal(t, false, wsm.HasSubscribers("athlete:2"))
+	subscriber, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	defer subscriber.Close()
+	_, msg, err := subscriber.ReadMessage()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, firstMsg, string(msg))
+	assert.Equal(t, true, wsm.HasSubscribers("athlete:2"))
+	assert.Equal(t, false, wsm.HasSubscribers("athlete:3"))
+	assert.True(t, testutil.ToFloat64(metrics.WSClients) >= 1)
+
+	// Subscriber receives only messages of its topic
+	wsm.SendMessageToAll([]byte(updateMsg1))
+	wsm.SendMessageToTopic([]byte(updateMsg2), "athlete:3")
+	wsm.SendMessageToTopic([]byte("athlete 2 update"), "athlete:2")
+	_, msg, err = subscriber.ReadMessage()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "athlete 2 update", string(msg))
+}
+
+func TestWebSocketShutdown(t *testing.T) {
+	manager := NewWSManager()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := manager.Upgrade(w, r, nil)
+		if err != nil {
+			log.Fatal(err.Error())
+			return
+		}
+		clientID := manager.AddClient(ws, logrus.New())
+		go manager.SendMessageToOne([]byte(firstMsg), clientID)
+		manager.StartClient(clientID)
+	}))
+	defer s.Close()
+
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	u.Scheme = "ws"
+
+	client, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	defer client.Close()
+	_, msg, err := client.ReadMessage()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, firstMsg, string(msg))
+
+	shutdownErr := make(chan error)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdownErr <- manager.Shutdown(ctx, "server restarting")
+	}()
+
+	// Reading close frame makes client to reply with close frame
+	_, _, err = client.ReadMessage()
+	assert.Equal(t, true, websocket.IsCloseError(err, websocket.CloseServiceRestart))
+	assert.Equal(t, "server restarting", err.(*websocket.CloseError).Text)
+	assert.Equal(t, nil, <-shutdownErr)
+	assert.Equal(t, false, manager.HasSubscribers(""))
+}
+
+func TestWebSocketShutdownTimeout(t *testing.T) {
+	manager := NewWSManager()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := manager.Upgrade(w, r, nil)
+		if err != nil {
+			log.Fatal(err.Error())
+			return
+		}
+		manager.StartClient(manager.AddClient(ws, logrus.New()))
+	}))
+	defer s.Close()
+
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	u.Scheme = "ws"
+
+	// Client never reads, so it does not reply to close frame
+	client, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	defer client.Close()
+	for !manager.HasSubscribers("") {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, manager.Shutdown(ctx, "server restarting"))
+	// Connection is closed by server, client is removed
+	for manager.HasSubscribers("") {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWebSocketLimits(t *testing.T) {
+	manager := NewWSManager()
+	manager.SetLimits(Limits{MaxClients: 1, AllowedOrigins: []string{"https://results.example.com"}})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := manager.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		manager.StartClient(manager.AddClient(ws, logrus.New()))
+	}))
+	defer s.Close()
+
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	u.Scheme = "ws"
+
+	_, resp, err := websocket.DefaultDialer.Dial(u.String(), http.Header{"Origin": {"https://evil.example.com"}})
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	client, _, err := websocket.DefaultDialer.Dial(u.String(), http.Header{"Origin": {"https://results.example.com"}})
+	assert.Equal(t, nil, err)
+	defer client.Close()
+	for !manager.HasSubscribers("") {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	_, resp, err = websocket.DefaultDialer.Dial(u.String(), http.Header{"Origin": {"https://results.example.com"}})
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestSampler(t *testing.T) {
+	s := &sampler{}
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, true, s.sample())
+	}
+
+	manager := NewWSManager()
+	manager.SetMessageSampling(3)
+	s = manager.(wsManager).sampler
+	sampled := []bool{}
+	for i := 0; i < 7; i++ {
+		sampled = append(sampled, s.sample())
+	}
+	assert.Equal(t, []bool{true, false, false, true, false, false, true}, sampled)
+}
+
+func TestSendToRemovedClient(t *testing.T) {
+	client := connectedWSClient{SendUpdates: make(chan []byte), removed: make(chan struct{})}
+	sent := make(chan bool)
+	go func() {
+		client.send([]byte(updateMsg1))
+		sent <- true
+	}()
+	close(client.removed)
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("send is blocked after client was removed")
+	}
+}